@@ -0,0 +1,194 @@
+package redimock
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// client is the state of a single connection. the reader must be kept for the
+// entire life of the connection, since a client can pipeline several commands
+// in one write and the buffered data belongs to the next commands
+type client struct {
+	id          uint64
+	conn        io.ReadWriteCloser
+	rd          *bufio.Reader
+	wr          *respWriter
+	connectedAt time.Time
+	// rejected is true when the server was full, it is not a real client
+	rejected bool
+	// kill is closed when the server closes the connection
+	kill     chan struct{}
+	killOnce sync.Once
+	// tlsServerName and tlsSubject are set after the TLS handshake
+	tlsServerName string
+	tlsSubject    string
+
+	// lock is for the state below and the protocol, they are changed by the
+	// connection and read in Server.Connections
+	lock     sync.Mutex
+	name     string
+	db       int
+	commands int
+}
+
+func newClient(conn io.ReadWriteCloser) *client {
+	return &client{
+		conn:        conn,
+		rd:          bufio.NewReader(conn),
+		wr:          &respWriter{w: conn, proto: Resp2},
+		connectedAt: time.Now(),
+		kill:        make(chan struct{}),
+	}
+}
+
+// readCommand reads the next command from the connection
+func (c *client) readCommand() ([]string, error) {
+	return readArray(c.rd)
+}
+
+// write buffers the response using the protocol version of this connection,
+// a response with invalid value is dropped completely
+func (c *client) write(args ...interface{}) error {
+	n, flushes := c.wr.buf.Len(), c.wr.flushes
+	if err := c.wr.write(args...); err != nil {
+		if c.wr.flushes != flushes {
+			// fragments are already flushed in the middle of the response
+			n = 0
+		}
+		c.wr.buf.Truncate(n)
+		return err
+	}
+	return nil
+}
+
+// reply writes the response, the buffer is flushed only when there is no more
+// pipelined command in the reader, so a pipeline batch is written at once. if
+// the slow write is enabled, the pending responses are flushed first and this
+// response is written slowly on its own. the written is called when the
+// response is in the buffer, before the client can see it
+func (c *client) reply(sw slowWrite, written func(error), args ...interface{}) error {
+	if sw.enabled() {
+		if err := c.flush(); err != nil {
+			written(err)
+			return err
+		}
+	}
+	err := c.write(args...)
+	written(err)
+	if err != nil {
+		return err
+	}
+	if sw.enabled() {
+		return c.wr.flushSlow(sw)
+	}
+	if c.rd.Buffered() > 0 {
+		return nil
+	}
+	return c.flush()
+}
+
+func (c *client) flush() error {
+	return c.wr.flush()
+}
+
+// track updates the connection state from the commands that change it, like
+// the protocol version in HELLO or the client name in CLIENT SETNAME. the state
+// is changed only if the response is not an error. it must be called before
+// writing the response, since the HELLO response itself is in the new protocol
+func (c *client) track(args []string, rsp []interface{}) {
+	for i := range rsp {
+		if _, ok := rsp[i].(Error); ok {
+			return
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "HELLO":
+		if len(args) < 2 {
+			return
+		}
+		v, err := strconv.Atoi(args[1])
+		if err != nil || (v != Resp2 && v != Resp3) {
+			return
+		}
+		c.wr.proto = v
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "AUTH":
+				// username and password
+				i += 2
+			case "SETNAME":
+				if i+1 < len(args) {
+					c.name = args[i+1]
+					i++
+				}
+			}
+		}
+	case "CLIENT":
+		if len(args) == 3 && strings.ToUpper(args[1]) == "SETNAME" {
+			c.name = args[2]
+		}
+	case "SELECT":
+		if len(args) != 2 {
+			return
+		}
+		if db, err := strconv.Atoi(args[1]); err == nil {
+			c.db = db
+		}
+	}
+}
+
+// received counts the commands of the connection
+func (c *client) received() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.commands++
+}
+
+// abort closes the connection from the server side, the pending pauses are
+// stopped too
+func (c *client) abort() {
+	c.killOnce.Do(func() {
+		close(c.kill)
+		_ = c.conn.Close()
+	})
+}
+
+// live is true for the accepted connections that are not killed yet
+func (c *client) live() bool {
+	return !c.rejected && !isClosed(c.kill)
+}
+
+// info returns the state of the connection for Server.Connections
+func (c *client) info() ConnectionInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	info := ConnectionInfo{
+		ID:          c.id,
+		Name:        c.name,
+		Protocol:    c.wr.proto,
+		DB:          c.db,
+		Commands:    c.commands,
+		ConnectedAt: c.connectedAt,
+	}
+	if conn, ok := c.conn.(interface{ RemoteAddr() net.Addr }); ok {
+		info.RemoteAddr = conn.RemoteAddr()
+	}
+	return info
+}
+
+func (c *client) close() error {
+	// the pending responses, in case of error in the middle of a pipeline
+	_ = c.flush()
+	return c.conn.Close()
+}
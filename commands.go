@@ -26,6 +26,31 @@ func (s *Server) ExpectPing() *Command {
 	})
 }
 
+// ExpectHello is the HELLO command with the protocol version, the connection
+// switches to this version after the reply. only version 2 and 3 are supported,
+// the extra is the optional AUTH and SETNAME arguments
+func (s *Server) ExpectHello(version int, extra ...string) *Command {
+	args := append([]string{fmt.Sprint(version)}, extra...)
+	c := s.Expect("HELLO").WithArgs(args...)
+	if version != Resp2 && version != Resp3 {
+		return c.WillReturn(Error("NOPROTO unsupported protocol version"))
+	}
+	return c.WillReturn(Map{
+		BulkString("server"), BulkString("redis"),
+		BulkString("version"), BulkString("7.2.0"),
+		BulkString("proto"), version,
+		BulkString("id"), 1,
+		BulkString("mode"), BulkString("standalone"),
+		BulkString("role"), BulkString("master"),
+		BulkString("modules"), []interface{}{},
+	})
+}
+
+// ExpectDel is the DEL command, the order of the keys is not important
+func (s *Server) ExpectDel(deleted int, keys ...string) *Command {
+	return s.Expect("DEL").WithArgMatchers(AnyOrder(keys...)).WillReturn(deleted)
+}
+
 // == String Commands == //
 
 // ExpectGet return a redis GET command
@@ -56,40 +81,51 @@ func (s *Server) ExpectSet(key string, value string, success bool, extra ...stri
 	})
 }
 
+// ExpectMSet is the MSET command, pairs is the key and value pairs and the order
+// of the pairs is not important
+func (s *Server) ExpectMSet(pairs ...string) *Command {
+	return s.Expect("MSET").WithArgMatchers(AnyOrderPairs(pairs...)).WillReturn("OK")
+}
+
 // == Hash Commands == //
 
 // ExpectHSet is the command HSET, if the update is true, then it means the key
-// was there already
-func (s *Server) ExpectHSet(key, field, value string, update bool) *Command {
-	ret := 1
+// was there already. more is the extra field and value pairs, the order of
+// the pairs is not important
+func (s *Server) ExpectHSet(key, field, value string, update bool, more ...string) *Command {
+	ret := 1 + len(more)/2
 	if update {
 		ret = 0
 	}
-	return s.Expect("HSET").WithArgs(key, field, value).WillReturn(ret)
+	pairs := append([]string{field, value}, more...)
+	return s.Expect("HSET").WithArgMatchers(Equal(key), AnyOrderPairs(pairs...)).WillReturn(ret)
 }
 
 // ExpectHGetAll return the HGETALL command
 func (s *Server) ExpectHGetAll(key string, ret map[string]string) *Command {
-	arr := make([]BulkString, 0, len(ret)*2)
-	for i := range ret {
-		arr = append(arr, BulkString(i), BulkString(ret[i]))
-	}
-	return s.Expect("HGETALL").WithArgs(key).WillReturn(arr)
+	return s.Expect("HGETALL").WithArgs(key).WillReturn(ret)
+}
+
+// == Set Commands == //
+
+// ExpectSAdd is the SADD command, the order of the members is not important
+func (s *Server) ExpectSAdd(added int, key string, members ...string) *Command {
+	return s.Expect("SADD").WithArgMatchers(Equal(key), AnyOrder(members...)).WillReturn(added)
 }
 
 // == List Commands == //
 
-// ExpectRPush is a wrapper for both lpush and rpush
+// ExpectRPush is a wrapper for both lpush and rpush. without values any value
+// is accepted, the order of the values is important since it changes the list
 func (s *Server) expectLRPush(cmd string, result int, key string, values ...string) *Command {
-	return s.Expect(cmd).WithFnArgs(func(in ...string) (x bool) {
-		if len(values) == 0 {
-			if len(in) == 0 {
-				return false
-			}
-			return in[0] == key
-		}
-		return equalArgs(in, append([]string{key}, values...))
-	}).WillReturn(result)
+	matchers := []ArgMatcher{Equal(key)}
+	if len(values) == 0 {
+		matchers = append(matchers, Rest(AnyArg()))
+	}
+	for i := range values {
+		matchers = append(matchers, Equal(values[i]))
+	}
+	return s.Expect(cmd).WithArgMatchers(matchers...).WillReturn(result)
 }
 
 // ExpectLPush is helper for lpush command
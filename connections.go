@@ -0,0 +1,88 @@
+package redimock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrNoConnection is returned when there is no live connection with the id
+	ErrNoConnection = errors.New("redimock: no such connection")
+	// ErrConnectionKilled is the error of a connection closed by KillConnection
+	// or KillAll, it wraps net.ErrClosed
+	ErrConnectionKilled = fmt.Errorf("redimock: connection killed: %w", net.ErrClosed)
+)
+
+// ConnectionInfo is the state of a live connection
+type ConnectionInfo struct {
+	// ID is the same as the ConnID in the calls
+	ID uint64
+	// RemoteAddr is the address of the client, nil if the connection has no address
+	RemoteAddr net.Addr
+	// Name is the name set by CLIENT SETNAME or HELLO SETNAME
+	Name string
+	// Protocol is the protocol version, 2 or 3 after HELLO 3
+	Protocol int
+	// DB is the database selected by SELECT
+	DB int
+	// Commands is the number of the commands received on the connection
+	Commands    int
+	ConnectedAt time.Time
+}
+
+// Connections returns the live connections, ordered by the id
+func (s *Server) Connections() []ConnectionInfo {
+	s.lock.RLock()
+	clients := make([]*client, 0, len(s.conns))
+	for cl := range s.conns {
+		// the killed ones are removed when their goroutine returns
+		if cl.live() {
+			clients = append(clients, cl)
+		}
+	}
+	s.lock.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	result := make([]ConnectionInfo, len(clients))
+	for i := range clients {
+		result[i] = clients[i].info()
+	}
+	return result
+}
+
+// KillConnection closes the connection with the id from the server side, like
+// CLIENT KILL or a network reset. it closes the connection even in the middle of
+// a command. the rejected connections are not considered, like Connections
+func (s *Server) KillConnection(id uint64) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for cl := range s.conns {
+		if cl.id == id && cl.live() {
+			cl.abort()
+			return nil
+		}
+	}
+	return ErrNoConnection
+}
+
+// KillAll closes all the live connections, the server keeps accepting the new
+// connections. it returns the number of the closed connections
+func (s *Server) KillAll() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var n int
+	for cl := range s.conns {
+		if cl.live() {
+			cl.abort()
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package redimock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnections(t *testing.T) {
+	s := NewTestServer(t)
+	s.Expect("SELECT").WithArgs("2").WillReturn("OK").Once()
+	s.Expect("CLIENT").WithArgs("SETNAME", "worker").WillReturn("OK").Once()
+	s.ExpectHello(3).Once()
+	s.ExpectPing().Any()
+
+	require.Empty(t, s.Connections())
+
+	// redigo does not support RESP3
+	conn1, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn1.Close()
+	_, err = conn1.Write([]byte("SELECT 2\r\nCLIENT SETNAME worker\r\nHELLO 3\r\n"))
+	require.NoError(t, err)
+	_, err = s.WaitForCommand(context.Background(), "HELLO")
+	require.NoError(t, err)
+
+	red2, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red2.Close()
+	_, err = red2.Do("PING")
+	require.NoError(t, err)
+	ping, err := s.WaitForCommand(context.Background(), "PING")
+	require.NoError(t, err)
+
+	conns := s.Connections()
+	require.Len(t, conns, 2)
+	require.Equal(t, "worker", conns[0].Name)
+	require.Equal(t, 2, conns[0].DB)
+	require.Equal(t, Resp3, conns[0].Protocol)
+	require.Equal(t, 3, conns[0].Commands)
+	require.Equal(t, "127.0.0.1", conns[0].RemoteAddr.(*net.TCPAddr).IP.String())
+	require.Empty(t, conns[1].Name)
+	require.Equal(t, Resp2, conns[1].Protocol)
+	require.Equal(t, 1, conns[1].Commands)
+	require.Equal(t, ping.ConnID, conns[1].ID)
+
+	require.NoError(t, s.KillConnection(conns[0].ID))
+	require.Equal(t, ErrNoConnection, s.KillConnection(conns[0].ID))
+	_, err = io.Copy(io.Discard, conn1)
+	require.NoError(t, err, "the connection must be closed by the server")
+	_, err = red2.Do("PING")
+	require.NoError(t, err)
+
+	require.Equal(t, 1, s.KillAll())
+	_, err = red2.Do("PING")
+	require.Error(t, err)
+	require.Eventually(t, func() bool {
+		return len(s.Connections()) == 0
+	}, time.Second, time.Millisecond)
+
+	// the server still accepts the new connections
+	red3, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red3.Close()
+	_, err = red3.Do("PING")
+	require.NoError(t, err)
+}
+
+func TestKillConnectionInCommand(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s := NewTestServer(t, WithNetwork("memory"), WithOnDisconnect(func(_ ConnectionInfo, err error) {
+		disconnected <- err
+	}))
+	cmd := s.ExpectGet("key", true, "v").WithDelay(time.Hour).Once()
+
+	red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+	require.NoError(t, err)
+	defer red.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := red.Do("GET", "key")
+		errCh <- err
+	}()
+	// the reply is not written during the delay
+	waitBusy(t, s)
+
+	require.Equal(t, 1, s.KillAll())
+	require.Error(t, <-errCh)
+
+	// the server is not closing, the call is in the journal without the reply
+	require.Equal(t, ErrConnectionKilled, <-disconnected)
+	require.True(t, errors.Is(ErrConnectionKilled, net.ErrClosed))
+	calls := s.Calls()
+	require.Len(t, calls, 1)
+	require.Equal(t, "GET key", calls[0].String())
+	require.Equal(t, ErrConnectionKilled, calls[0].Err)
+	require.Nil(t, calls[0].Reply)
+	require.True(t, calls[0].RepliedAt.IsZero())
+	require.Len(t, cmd.Calls(), 1)
+	ctx, cnl := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cnl()
+	require.Error(t, cmd.WaitCalled(ctx, 1), "the command is not replied")
+	select {
+	case <-s.Done():
+		t.Fatal("the command is not replied")
+	default:
+	}
+}
@@ -0,0 +1,68 @@
+package redimock
+
+// hooks are the callbacks of the server, they are called from the goroutine of
+// the connection, so a slow hook blocks the connection
+type hooks struct {
+	onConnect    func(ConnectionInfo)
+	onDisconnect func(ConnectionInfo, error)
+	onCommand    func(Call)
+	onReply      func(Call)
+}
+
+// WithOnConnect calls the fn when a connection is accepted, before reading any
+// command from it
+func WithOnConnect(fn func(ConnectionInfo)) Option {
+	return func(s *Server) {
+		s.hooks.onConnect = fn
+	}
+}
+
+// WithOnDisconnect calls the fn when a connection is closed, with the error
+// that closed it. it is io.EOF when the client closed the connection, nil
+// after a command with CloseConnection, ErrServerClosed when the server is
+// closing and ErrConnectionKilled after KillConnection or KillAll
+func WithOnDisconnect(fn func(ConnectionInfo, error)) Option {
+	return func(s *Server) {
+		s.hooks.onDisconnect = fn
+	}
+}
+
+// WithOnCommand calls the fn for each command before matching it with the
+// expectations, the Expectation and the Reply of the call are not set yet
+func WithOnCommand(fn func(Call)) Option {
+	return func(s *Server) {
+		s.hooks.onCommand = fn
+	}
+}
+
+// WithOnReply calls the fn for each command after writing the reply, with the
+// same call that is added to the journal
+func WithOnReply(fn func(Call)) Option {
+	return func(s *Server) {
+		s.hooks.onReply = fn
+	}
+}
+
+func (h hooks) connect(cl *client) {
+	if h.onConnect != nil {
+		h.onConnect(cl.info())
+	}
+}
+
+func (h hooks) disconnect(cl *client, err error) {
+	if h.onDisconnect != nil {
+		h.onDisconnect(cl.info(), err)
+	}
+}
+
+func (h hooks) command(call Call) {
+	if h.onCommand != nil {
+		h.onCommand(call)
+	}
+}
+
+func (h hooks) reply(call Call) {
+	if h.onReply != nil {
+		h.onReply(call)
+	}
+}
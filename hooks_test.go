@@ -0,0 +1,107 @@
+package redimock
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+type hookRecorder struct {
+	lock        sync.Mutex
+	connects    []ConnectionInfo
+	disconnects []error
+	commands    []string
+	replies     []Call
+}
+
+func (h *hookRecorder) options() []Option {
+	return []Option{
+		WithOnConnect(func(info ConnectionInfo) {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			h.connects = append(h.connects, info)
+		}),
+		WithOnDisconnect(func(_ ConnectionInfo, err error) {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			h.disconnects = append(h.disconnects, err)
+		}),
+		WithOnCommand(func(call Call) {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			h.commands = append(h.commands, call.String())
+		}),
+		WithOnReply(func(call Call) {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			h.replies = append(h.replies, call)
+		}),
+	}
+}
+
+func (h *hookRecorder) disconnected() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.disconnects)
+}
+
+func TestHooks(t *testing.T) {
+	var h hookRecorder
+	s := NewTestServer(t, h.options()...)
+	s.ExpectPing().Times(2)
+	s.Expect("QUIT").WillReturn("OK").CloseConnection().Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	require.NoError(t, red.Close())
+
+	red, err = redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	_, err = red.Do("QUIT")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return h.disconnected() == 2
+	}, time.Second, time.Millisecond)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	require.Len(t, h.connects, 2)
+	require.Equal(t, []error{io.EOF, nil}, h.disconnects)
+	require.Equal(t, []string{"PING", "PING", "QUIT"}, h.commands)
+	require.Len(t, h.replies, 3)
+	require.Equal(t, h.connects[1].ID, h.replies[2].ConnID)
+	require.NotNil(t, h.replies[2].Expectation)
+}
+
+func TestHooksPoolReuse(t *testing.T) {
+	var h hookRecorder
+	s := NewTestServer(t, h.options()...)
+	s.ExpectPing().Any()
+
+	cl := goredis.NewClient(&goredis.Options{
+		Addr:     s.Addr().String(),
+		PoolSize: 1,
+	})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, cl.Ping().Err())
+	}
+	require.NoError(t, cl.Close())
+
+	require.NoError(t, s.Close())
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	require.Len(t, h.connects, 1, "the pool must reuse the connection")
+	require.Len(t, h.commands, 5)
+	require.Len(t, h.disconnects, 1)
+}
@@ -0,0 +1,137 @@
+package redimock
+
+import (
+	"strings"
+	"time"
+)
+
+// Call is a single command received by the server
+type Call struct {
+	// ConnID is the connection id, unique for each connection of the server
+	ConnID uint64
+	// ClientName is the name set by CLIENT SETNAME or HELLO SETNAME before this call
+	ClientName string
+	// TLSServerName is the server name (SNI) sent by the client in TLS handshake
+	TLSServerName string
+	// TLSSubject is the subject of the verified client certificate in mutual TLS
+	TLSSubject string
+	// Command is the command name in upper case
+	Command string
+	// Args is the arguments of the command, without the command name
+	Args       []string
+	ReceivedAt time.Time
+	RepliedAt  time.Time
+	// Expectation is the matched expectation, nil if the command was not expected
+	Expectation *Command
+	// Reply is the values sent as the reply
+	Reply []interface{}
+	// Err is the error in writing the reply
+	Err error
+}
+
+// String returns the command and the arguments
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Command}, c.Args...), " ")
+}
+
+// journalEntry is the position of a call in the journals, to set the reply
+// after writing it
+type journalEntry struct {
+	cmd     *Command
+	server  int
+	command int
+}
+
+// record adds the call to the journal of the server and the matched command.
+// it must be called before writing the reply, so a client that has the reply
+// always finds the call in the journal
+func (s *Server) record(call Call, cmd *Command, rsp []interface{}) journalEntry {
+	call.Expectation = cmd
+	call.Reply = rsp
+	e := journalEntry{cmd: cmd}
+
+	if cmd != nil {
+		cmd.lock.Lock()
+		e.command = len(cmd.calls)
+		cmd.calls = append(cmd.calls, call)
+		cmd.lock.Unlock()
+	}
+
+	s.lock.Lock()
+	e.server = len(s.calls)
+	s.calls = append(s.calls, call)
+	s.lock.Unlock()
+	return e
+}
+
+// written sets the reply time of the recorded call, it is called when the
+// reply is ready to be sent and before the client can see it
+func (s *Server) written(e journalEntry, err error) {
+	now := time.Now()
+	if e.cmd != nil {
+		e.cmd.lock.Lock()
+		c := &e.cmd.calls[e.command]
+		c.RepliedAt, c.Err = now, err
+		if e.cmd.changed != nil {
+			close(e.cmd.changed)
+			e.cmd.changed = nil
+		}
+		e.cmd.lock.Unlock()
+	}
+
+	s.lock.Lock()
+	c := &s.calls[e.server]
+	c.RepliedAt, c.Err = now, err
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+	s.checkDone()
+	s.lock.Unlock()
+}
+
+// replied sets the error of sending the reply, if any, and calls the logger
+// and the hooks with the final call
+func (s *Server) replied(e journalEntry, err error) {
+	if err != nil && e.cmd != nil {
+		e.cmd.lock.Lock()
+		e.cmd.calls[e.command].Err = err
+		e.cmd.lock.Unlock()
+	}
+
+	s.lock.Lock()
+	if err != nil {
+		s.calls[e.server].Err = err
+	}
+	call := s.calls[e.server]
+	s.lock.Unlock()
+
+	s.logReply(call)
+	s.hooks.reply(call)
+}
+
+// replyTo writes the reply of the recorded call and keeps the journal updated
+func (s *Server) replyTo(cl *client, e journalEntry, sw slowWrite, rsp ...interface{}) error {
+	err := cl.reply(sw, func(err error) {
+		s.written(e, err)
+	}, rsp...)
+	s.replied(e, err)
+	return err
+}
+
+// Calls returns all the commands received by the server in order, including
+// the unexpected ones
+func (s *Server) Calls() []Call {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// Calls returns the calls matched with this command in order
+func (c *Command) Calls() []Call {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return append([]Call(nil), c.calls...)
+}
@@ -0,0 +1,86 @@
+package redimock
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	name := s.Expect("CLIENT").WithArgs("SETNAME", "worker").WillReturn("OK").Once()
+	set := s.Expect("SET").WithArgMatchers(Equal("key"), AnyArg(), Equal("EX"), IntRange(1, 3600)).
+		WillReturn("OK").Times(2)
+
+	red, err := redis.Dial("tcp", s.Addr().String(), redis.DialClientName("worker"))
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("SET", "key", "v1", "EX", 60)
+	require.NoError(t, err)
+
+	red2, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red2.Close()
+
+	_, err = red2.Do("SET", "key", "v2", "EX", 120)
+	require.NoError(t, err)
+	_, err = red2.Do("GET", "key")
+	require.Error(t, err)
+
+	calls := s.Calls()
+	require.Len(t, calls, 4)
+
+	require.Equal(t, "CLIENT SETNAME worker", calls[0].String())
+	require.Equal(t, name, calls[0].Expectation)
+	require.Equal(t, "", calls[0].ClientName)
+
+	require.Equal(t, "SET", calls[1].Command)
+	require.Equal(t, []string{"key", "v1", "EX", "60"}, calls[1].Args)
+	require.Equal(t, "worker", calls[1].ClientName)
+	require.Equal(t, calls[0].ConnID, calls[1].ConnID)
+	require.Equal(t, []interface{}{"OK"}, calls[1].Reply)
+	require.NoError(t, calls[1].Err)
+	require.False(t, calls[1].RepliedAt.Before(calls[1].ReceivedAt))
+
+	require.NotEqual(t, calls[1].ConnID, calls[2].ConnID)
+	require.Equal(t, "", calls[2].ClientName)
+
+	require.Nil(t, calls[3].Expectation)
+	require.Equal(t, "GET key", calls[3].String())
+	require.Equal(t, []interface{}{Error("command not expected")}, calls[3].Reply)
+
+	setCalls := set.Calls()
+	require.Len(t, setCalls, 2)
+	require.Equal(t, "60", setCalls[0].Args[3])
+	require.Equal(t, "120", setCalls[1].Args[3])
+	require.Len(t, name.Calls(), 1)
+}
+
+func TestJournalHelloName(t *testing.T) {
+	s := &Server{}
+	s.ExpectHello(3, "SETNAME", "app").Once()
+	s.ExpectPing().Once()
+	s.ExpectHello(2, "AUTH", "user", "SETNAME", "bad").WillReturn(Error("WRONGPASS")).Once()
+	s.ExpectPing().Once()
+
+	conn := &batchConn{
+		in: bytes.NewBufferString("HELLO 3 SETNAME app\r\nPING\r\nHELLO 2 AUTH user SETNAME bad\r\nPING\r\n"),
+	}
+	require.Equal(t, io.EOF, s.serveConn(conn))
+
+	calls := s.Calls()
+	require.Len(t, calls, 4)
+	require.Equal(t, "app", calls[1].ClientName)
+	require.Equal(t, "app", calls[3].ClientName)
+	require.NoError(t, s.ExpectationsWereMet())
+}
@@ -0,0 +1,91 @@
+package redimock
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+)
+
+// errMaxClients is the error of the rejected connections, like redis
+var errMaxClients = errors.New("ERR max number of clients reached")
+
+// RejectMode is how the connections are rejected when the server has the
+// maximum number of clients
+type RejectMode int
+
+const (
+	// RejectWithError writes the max clients error and closes the connection,
+	// like redis
+	RejectWithError RejectMode = iota
+	// RejectReset accepts the connection and then closes it with a reset (RST,
+	// if the connection supports SetLinger). it is not refused before accept,
+	// the client sees a successful connect and then ECONNRESET
+	RejectReset
+	// RejectClose closes the connection right after accepting it
+	RejectClose
+	// RejectHang accepts the connection and never answers, until the client or
+	// the server closes it
+	RejectHang
+)
+
+// WithMaxClients limits the number of the connections, the new connections
+// after the limit are rejected. the rejected connections are not in the
+// Connections, KillConnection and KillAll do not close them and they do not
+// count for the limit. they are closed with the server
+func WithMaxClients(n int) Option {
+	return func(s *Server) {
+		s.maxClients = n
+	}
+}
+
+// WithRejectMode sets how the connections are rejected with WithMaxClients, the
+// default is RejectWithError
+func WithRejectMode(mode RejectMode) Option {
+	return func(s *Server) {
+		s.rejectMode = mode
+	}
+}
+
+// liveClients is the number of the accepted clients that are not killed, the
+// lock must be held by the caller
+func (s *Server) liveClients() int {
+	var n int
+	for cl := range s.conns {
+		if cl.live() {
+			n++
+		}
+	}
+	return n
+}
+
+// reject handles a connection after the max clients, the connection is closed
+// by the caller
+func (s *Server) reject(cl *client) error {
+	s.log(slog.LevelWarn, "connection rejected", "conn", cl.id, "error", errMaxClients)
+	switch s.rejectMode {
+	case RejectReset:
+		var conn io.ReadWriteCloser = cl.conn
+		if tc, ok := conn.(*tls.Conn); ok {
+			conn = tc.NetConn()
+		}
+		if conn, ok := conn.(interface{ SetLinger(int) error }); ok {
+			_ = conn.SetLinger(0)
+		}
+	case RejectClose:
+	case RejectHang:
+		// wait for the client or the server to close it
+		_, _ = io.Copy(io.Discard, cl.conn)
+	default:
+		if err := cl.handshake(); err != nil {
+			return err
+		}
+		if err := cl.write(Error(errMaxClients.Error())); err != nil {
+			return err
+		}
+		if err := cl.flush(); err != nil {
+			return err
+		}
+	}
+	return errMaxClients
+}
@@ -0,0 +1,132 @@
+package redimock
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxClients(t *testing.T) {
+	s := NewTestServer(t, WithMaxClients(2))
+	s.ExpectPing().Any()
+
+	var conns []redis.Conn
+	for i := 0; i < 2; i++ {
+		red, err := redis.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		defer red.Close()
+		_, err = red.Do("PING")
+		require.NoError(t, err)
+		conns = append(conns, red)
+	}
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.EqualError(t, err, "ERR max number of clients reached")
+	_, err = red.Do("PING")
+	require.Error(t, err)
+	require.Len(t, s.Connections(), 2)
+
+	// a slot is free after a client is closed
+	require.NoError(t, conns[0].Close())
+	require.Eventually(t, func() bool {
+		return len(s.Connections()) == 1
+	}, time.Second, time.Millisecond)
+
+	red, err = redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	require.Len(t, s.Calls(), 3, "the rejected connections are not in the journal")
+}
+
+func TestRejectModes(t *testing.T) {
+	for _, mode := range []RejectMode{RejectReset, RejectClose} {
+		s := NewTestServer(t, WithMaxClients(1), WithRejectMode(mode))
+		s.ExpectPing().Any()
+
+		red, err := redis.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		defer red.Close()
+		_, err = red.Do("PING")
+		require.NoError(t, err)
+
+		conn, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		n, err := io.Copy(io.Discard, conn)
+		require.Zero(t, n)
+		if mode == RejectClose {
+			require.NoError(t, err, "EOF is expected")
+		} else {
+			require.True(t, errors.Is(err, syscall.ECONNRESET), "RST is expected, got %v", err)
+		}
+	}
+}
+
+func TestRejectHang(t *testing.T) {
+	s := NewTestServer(t, WithMaxClients(1), WithRejectMode(RejectHang))
+	s.ExpectPing().Any()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	hang, err := redis.Dial("tcp", s.Addr().String(), redis.DialReadTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	defer hang.Close()
+	_, err = hang.Do("PING")
+	require.Error(t, err)
+	netErr, ok := err.(net.Error)
+	require.True(t, ok)
+	require.True(t, netErr.Timeout())
+
+	require.Len(t, s.Connections(), 1)
+	raw, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer raw.Close()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, raw.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+		_, err = raw.Read(make([]byte, 1))
+		netErr, ok = err.(net.Error)
+		require.True(t, ok, "unexpected error: %v", err)
+		require.True(t, netErr.Timeout())
+		if i == 0 {
+			require.Equal(t, 1, s.KillAll(), "the rejected connections are not killed")
+		}
+	}
+	require.NoError(t, s.Close(), "the hanging connections must be closed too")
+}
+
+// lingerConn records the SetLinger calls, like a *net.TCPConn
+type lingerConn struct {
+	net.Conn
+	linger []int
+}
+
+func (c *lingerConn) SetLinger(sec int) error {
+	c.linger = append(c.linger, sec)
+	return nil
+}
+
+func TestRejectResetTLS(t *testing.T) {
+	s := &Server{rejectMode: RejectReset}
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := &lingerConn{Conn: server}
+
+	require.Equal(t, errMaxClients, s.reject(newClient(tls.Server(conn, &tls.Config{}))))
+	require.Equal(t, []int{0}, conn.linger, "the connection under the TLS must be reset")
+}
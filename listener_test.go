@@ -0,0 +1,113 @@
+package redimock
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// faultListener accepts connections that fail all the writes after limit
+type faultListener struct {
+	net.Listener
+	limit int
+}
+
+func (l faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn, limit: l.limit}, nil
+}
+
+type faultConn struct {
+	net.Conn
+	limit int
+}
+
+func (c *faultConn) Write(p []byte) (int, error) {
+	if c.limit <= 0 {
+		return 0, net.ErrClosed
+	}
+	c.limit--
+	return c.Conn.Write(p)
+}
+
+func TestNewServerFromListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s, err := NewServerFromListener(context.Background(), faultListener{Listener: l, limit: 1})
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, l.Addr(), s.NetAddr())
+	s.ExpectPing().Any()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	_, err = red.Do("PING")
+	require.Error(t, err, "the second write must fail")
+
+	calls := s.Calls()
+	require.Len(t, calls, 2)
+	require.NoError(t, calls[0].Err)
+	require.Equal(t, net.ErrClosed, calls[1].Err)
+
+	require.NoError(t, s.Close())
+	_, err = l.Accept()
+	require.Error(t, err, "the listener must be closed")
+}
+
+func TestServeConn(t *testing.T) {
+	s := &Server{}
+	s.ExpectPing().Any()
+
+	server, client := net.Pipe()
+	ctx, cnl := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ServeConn(ctx, server)
+	}()
+
+	red := redis.NewConn(client, time.Second, time.Second)
+	defer red.Close()
+	_, err := red.Do("PING")
+	require.NoError(t, err)
+
+	cnl()
+	require.Equal(t, context.Canceled, <-errCh)
+	_, err = red.Do("PING")
+	require.Error(t, err)
+
+	s = NewTestServer(t)
+	require.NoError(t, s.Close())
+	server, client = net.Pipe()
+	defer client.Close()
+	require.Equal(t, ErrServerClosed, s.ServeConn(context.Background(), server))
+}
+
+func TestServeConnClose(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+	s.ExpectPing().Once()
+
+	server, client := net.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ServeConn(context.Background(), server)
+	}()
+
+	red := redis.NewConn(client, time.Second, time.Second)
+	defer red.Close()
+	_, err := red.Do("PING")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Close())
+	require.Error(t, <-errCh)
+}
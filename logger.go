@@ -0,0 +1,102 @@
+package redimock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// WithLogger logs the connections, the protocol errors and the unexpected
+// commands. with the debug level, each request and reply is logged too
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+func (s *Server) log(level slog.Level, msg string, args ...interface{}) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.Log(context.Background(), level, msg, args...)
+}
+
+func (s *Server) logConnect(cl *client) {
+	if s.logger == nil {
+		return
+	}
+	info := cl.info()
+	args := []interface{}{"conn", info.ID}
+	if info.RemoteAddr != nil {
+		args = append(args, "remote", info.RemoteAddr.String())
+	}
+	s.log(slog.LevelInfo, "connection opened", args...)
+}
+
+func (s *Server) logDisconnect(cl *client, err error) {
+	switch {
+	case errors.Is(err, ErrConnectionKilled):
+		s.log(slog.LevelInfo, "connection killed", "conn", cl.id)
+	case err == nil, errors.Is(err, io.EOF), errors.Is(err, ErrServerClosed), errors.Is(err, net.ErrClosed):
+		s.log(slog.LevelInfo, "connection closed", "conn", cl.id)
+	case errors.Is(err, ErrProtocol):
+		s.log(slog.LevelWarn, "protocol error", "conn", cl.id, "error", err)
+	default:
+		s.log(slog.LevelWarn, "connection closed", "conn", cl.id, "error", err)
+	}
+}
+
+func (s *Server) logReply(call Call) {
+	if s.logger == nil {
+		return
+	}
+	args := []interface{}{"conn", call.ConnID, "command", call.String(), "reply", formatReply(call.Reply)}
+	if call.Err != nil {
+		s.log(slog.LevelWarn, "writing the reply failed", append(args, "error", call.Err)...)
+		return
+	}
+	s.log(slog.LevelDebug, "reply", args...)
+}
+
+// formatReply is a human readable form of the reply, like redis-cli
+func formatReply(rsp []interface{}) string {
+	parts := make([]string, len(rsp))
+	for i := range rsp {
+		parts[i] = formatValue(rsp[i])
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil, Null, NullArray:
+		return "(nil)"
+	case Error:
+		return "(error) " + string(t)
+	case error:
+		return "(error) " + t.Error()
+	case string:
+		return strconv.Quote(t)
+	case SimpleString:
+		return string(t)
+	case BulkString:
+		return strconv.Quote(string(t))
+	case []byte:
+		return strconv.Quote(string(t))
+	case Raw:
+		return fmt.Sprintf("(raw) %q", string(t))
+	case []interface{}:
+		return "[" + formatReply(t) + "]"
+	case Array:
+		return "[" + formatReply(t) + "]"
+	case EmptyArray:
+		return "[]"
+	default:
+		return fmt.Sprint(t)
+	}
+}
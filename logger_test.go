@@ -0,0 +1,90 @@
+package redimock
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a buffer safe for the logs of many connections
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestLogger(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	s, err := NewServer(context.Background(), "127.0.0.1:0", WithLogger(logger))
+	require.NoError(t, err)
+	s.ExpectGet("key", true, "value").Once()
+	s.Expect("LRANGE").WithAnyArgs().WillReturn([]interface{}{"a", nil}).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	_, err = red.Do("GET", "key")
+	require.NoError(t, err)
+	_, err = red.Do("LRANGE", "list", 0, -1)
+	require.NoError(t, err)
+	_, err = red.Do("DEL", "key")
+	require.Error(t, err)
+	require.NoError(t, red.Close())
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("*1\r\n$x\r\n"))
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, conn)
+	require.NoError(t, err, "the server must close the connection")
+	require.NoError(t, s.Close())
+
+	logs := buf.String()
+	for _, line := range []string{
+		`level=INFO msg="connection opened" conn=1 remote=127.0.0.1:`,
+		`level=DEBUG msg=request conn=1 command="GET key"`,
+		`level=DEBUG msg=reply conn=1 command="GET key" reply="\"value\""`,
+		`level=DEBUG msg=reply conn=1 command="LRANGE list 0 -1" reply="[\"a\" (nil)]"`,
+		`level=WARN msg="unexpected command" conn=1 command="DEL key" error="command DEL key is called but not expected`,
+		`level=INFO msg="connection closed" conn=1`,
+		`level=WARN msg="protocol error" conn=2 error="invalid request"`,
+	} {
+		assert.Contains(t, logs, line)
+	}
+}
+
+func TestFormatReply(t *testing.T) {
+	assert.Equal(t, `OK 1 "bulk" (error) ERR x (nil) [] [1 [(nil)]] (raw) "+a\r\n"`, formatReply([]interface{}{
+		SimpleString("OK"), 1, BulkString("bulk"), Error("ERR x"), nil, EmptyArray{},
+		Array{1, []interface{}{NullArray{}}}, Raw("+a\r\n"),
+	}))
+}
@@ -0,0 +1,339 @@
+package redimock
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ArgMatcher is used to match a single argument of a command in WithArgMatchers,
+// the String is used in the error messages
+type ArgMatcher interface {
+	Match(arg string) bool
+	String() string
+}
+
+type matcherFunc struct {
+	fn   func(string) bool
+	desc string
+}
+
+func (m matcherFunc) Match(arg string) bool {
+	return m.fn(arg)
+}
+
+func (m matcherFunc) String() string {
+	return m.desc
+}
+
+// MatcherFunc creates a matcher from a function and a description
+func MatcherFunc(desc string, fn func(string) bool) ArgMatcher {
+	return matcherFunc{fn: fn, desc: desc}
+}
+
+// Equal matches the exact argument
+func Equal(s string) ArgMatcher {
+	return MatcherFunc(strconv.Quote(s), func(arg string) bool {
+		return arg == s
+	})
+}
+
+// AnyArg matches any argument
+func AnyArg() ArgMatcher {
+	return MatcherFunc("<any>", func(string) bool {
+		return true
+	})
+}
+
+// Regex matches the argument with the regular expression, it panics if the
+// expression is invalid, like regexp.MustCompile
+func Regex(expr string) ArgMatcher {
+	re := regexp.MustCompile(expr)
+	return MatcherFunc("/"+expr+"/", re.MatchString)
+}
+
+// Prefix matches the argument starting with the prefix
+func Prefix(prefix string) ArgMatcher {
+	return MatcherFunc(strconv.Quote(prefix)+"*", func(arg string) bool {
+		return strings.HasPrefix(arg, prefix)
+	})
+}
+
+// Glob matches the argument with the glob pattern, the same as the redis KEYS
+// pattern. it supports *, ?, [abc], [^a], [a-z] and \ for escape
+func Glob(pattern string) ArgMatcher {
+	return MatcherFunc("glob("+strconv.Quote(pattern)+")", func(arg string) bool {
+		return globMatch(pattern, arg)
+	})
+}
+
+// IntRange matches the integer arguments between min and max (inclusive)
+func IntRange(min, max int64) ArgMatcher {
+	return MatcherFunc(fmt.Sprintf("[%d..%d]", min, max), func(arg string) bool {
+		v, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return false
+		}
+		return v >= min && v <= max
+	})
+}
+
+// OneOf matches if the argument is equal to one of the values
+func OneOf(values ...string) ArgMatcher {
+	quoted := make([]string, len(values))
+	for i := range values {
+		quoted[i] = strconv.Quote(values[i])
+	}
+	return MatcherFunc("oneof("+strings.Join(quoted, ", ")+")", func(arg string) bool {
+		for i := range values {
+			if values[i] == arg {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// JSONEq matches if the argument is a JSON equal to the expected JSON, the
+// order of the keys and the spaces are not important
+func JSONEq(expected string) ArgMatcher {
+	var exp interface{}
+	expErr := json.Unmarshal([]byte(expected), &exp)
+	return MatcherFunc("json("+expected+")", func(arg string) bool {
+		if expErr != nil {
+			return false
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(arg), &v); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(exp, v)
+	})
+}
+
+// CaseInsensitive matches the argument ignoring the case
+func CaseInsensitive(s string) ArgMatcher {
+	return MatcherFunc("i"+strconv.Quote(s), func(arg string) bool {
+		return strings.EqualFold(arg, s)
+	})
+}
+
+// Not reverses the matcher
+func Not(m ArgMatcher) ArgMatcher {
+	return MatcherFunc("not("+m.String()+")", func(arg string) bool {
+		return !m.Match(arg)
+	})
+}
+
+// tailMatcher is a matcher for all the remaining arguments, it must be the
+// last matcher
+type tailMatcher interface {
+	matchTail(args []string) bool
+}
+
+type restMatcher struct {
+	ArgMatcher
+}
+
+func (r restMatcher) String() string {
+	return r.ArgMatcher.String() + "..."
+}
+
+func (r restMatcher) matchTail(args []string) bool {
+	for i := range args {
+		if !r.Match(args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rest matches all the remaining arguments (zero or more) with the matcher, it
+// must be the last matcher
+func Rest(m ArgMatcher) ArgMatcher {
+	return restMatcher{ArgMatcher: m}
+}
+
+type anyOrderMatcher struct {
+	values []string
+	pairs  bool
+}
+
+func (a anyOrderMatcher) Match(arg string) bool {
+	return a.matchTail([]string{arg})
+}
+
+func (a anyOrderMatcher) String() string {
+	if a.pairs {
+		var pairs []string
+		for i := 0; i+1 < len(a.values); i += 2 {
+			pairs = append(pairs, strconv.Quote(a.values[i])+" "+strconv.Quote(a.values[i+1]))
+		}
+		return "anyorder(" + strings.Join(pairs, ", ") + ")"
+	}
+	quoted := make([]string, len(a.values))
+	for i := range a.values {
+		quoted[i] = strconv.Quote(a.values[i])
+	}
+	return "anyorder(" + strings.Join(quoted, " ") + ")"
+}
+
+func (a anyOrderMatcher) matchTail(args []string) bool {
+	if len(args) != len(a.values) {
+		return false
+	}
+	if !a.pairs {
+		return sameItems(args, a.values)
+	}
+	if len(args)%2 != 0 {
+		return false
+	}
+	in, expected := make([]string, 0, len(args)/2), make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		// the quote makes sure there is no collision between the pairs
+		in = append(in, strconv.Quote(args[i])+" "+strconv.Quote(args[i+1]))
+		expected = append(expected, strconv.Quote(a.values[i])+" "+strconv.Quote(a.values[i+1]))
+	}
+	return sameItems(in, expected)
+}
+
+// AnyOrder matches all the remaining arguments with the values in any order,
+// like the members in SADD or keys in DEL. it must be the last matcher
+func AnyOrder(values ...string) ArgMatcher {
+	return anyOrderMatcher{values: values}
+}
+
+// AnyOrderPairs matches all the remaining arguments as pairs, like the field
+// and value in HSET or key and value in MSET. the order of the pairs is not
+// important, but each pair must be in order. it must be the last matcher
+func AnyOrderPairs(pairs ...string) ArgMatcher {
+	return anyOrderMatcher{values: pairs, pairs: true}
+}
+
+// sameItems checks if both have the same items, with the same repeat count
+func sameItems(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int, len(a))
+	for i := range a {
+		count[a[i]]++
+	}
+	for i := range b {
+		count[b[i]]--
+		if count[b[i]] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// matchArgs matches the arguments with the matchers, each matcher is for one
+// argument, except the Rest and AnyOrder matchers at the end
+func matchArgs(in []string, matchers []ArgMatcher) bool {
+	for i, m := range matchers {
+		if t, ok := m.(tailMatcher); ok && i == len(matchers)-1 {
+			if i > len(in) {
+				return false
+			}
+			return t.matchTail(in[i:])
+		}
+		if i >= len(in) || !m.Match(in[i]) {
+			return false
+		}
+	}
+	return len(in) == len(matchers)
+}
+
+func describeMatchers(matchers []ArgMatcher) string {
+	desc := make([]string, len(matchers))
+	for i := range matchers {
+		desc[i] = matchers[i].String()
+	}
+	return strings.Join(desc, " ")
+}
+
+// globMatch is the redis glob style pattern matching
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			var (
+				i     = 1
+				not   bool
+				match bool
+			)
+			if i < len(pattern) && pattern[i] == '^' {
+				not = true
+				i++
+			}
+			for ; i < len(pattern) && pattern[i] != ']'; i++ {
+				switch {
+				case pattern[i] == '\\' && i+1 < len(pattern):
+					i++
+					if pattern[i] == s[0] {
+						match = true
+					}
+				case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+					start, end := pattern[i], pattern[i+2]
+					if start > end {
+						start, end = end, start
+					}
+					if s[0] >= start && s[0] <= end {
+						match = true
+					}
+					i += 2
+				case pattern[i] == s[0]:
+					match = true
+				}
+			}
+			if match == not {
+				return false
+			}
+			if i < len(pattern) {
+				// skip the ]
+				pattern = pattern[i:]
+			} else {
+				// unclosed bracket, the end of the pattern
+				pattern = pattern[len(pattern)-1:]
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,163 @@
+package redimock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchers(t *testing.T) {
+	type cas struct {
+		m     ArgMatcher
+		match []string
+		fail  []string
+		desc  string
+	}
+	for _, c := range []cas{
+		{m: Equal("a"), match: []string{"a"}, fail: []string{"A", ""}, desc: `"a"`},
+		{m: AnyArg(), match: []string{"", "x"}, desc: "<any>"},
+		{m: Regex(`^user:\d+$`), match: []string{"user:1"}, fail: []string{"user:x"}, desc: `/^user:\d+$/`},
+		{m: Prefix("session:"), match: []string{"session:", "session:abc"}, fail: []string{"sess"}, desc: `"session:"*`},
+		{m: IntRange(10, 20), match: []string{"10", "20", "15"}, fail: []string{"9", "21", "1.5", "x"}, desc: "[10..20]"},
+		{m: OneOf("EX", "PX"), match: []string{"EX", "PX"}, fail: []string{"ex"}, desc: `oneof("EX", "PX")`},
+		{
+			m:     JSONEq(`{"a": 1, "b": [1, 2]}`),
+			match: []string{`{"b":[1,2],"a":1}`},
+			fail:  []string{`{"a":1}`, `not json`},
+			desc:  `json({"a": 1, "b": [1, 2]})`,
+		},
+		{m: JSONEq(`invalid`), fail: []string{`invalid`}},
+		{m: CaseInsensitive("nx"), match: []string{"NX", "nx", "Nx"}, fail: []string{"xx"}, desc: `i"nx"`},
+		{m: Not(Equal("a")), match: []string{"b"}, fail: []string{"a"}, desc: `not("a")`},
+		{m: Glob("user:*"), match: []string{"user:", "user:1:name"}, fail: []string{"usr:1"}, desc: `glob("user:*")`},
+		{m: Glob("h?llo"), match: []string{"hello", "hallo"}, fail: []string{"hllo", "heello"}},
+		{m: Glob("h[ae]llo"), match: []string{"hello", "hallo"}, fail: []string{"hillo"}},
+		{m: Glob("h[^e]llo"), match: []string{"hallo"}, fail: []string{"hello"}},
+		{m: Glob("h[a-c]llo"), match: []string{"hbllo"}, fail: []string{"hdllo"}},
+		{m: Glob(`h\*llo`), match: []string{"h*llo"}, fail: []string{"hello"}},
+		{m: Glob("a**b"), match: []string{"ab", "axxb"}, fail: []string{"axxc"}},
+		{m: Glob("a[bc"), match: []string{"ab"}, fail: []string{"ad"}},
+	} {
+		for _, a := range c.match {
+			assert.True(t, c.m.Match(a), "%s should match %q", c.m, a)
+		}
+		for _, a := range c.fail {
+			assert.False(t, c.m.Match(a), "%s should not match %q", c.m, a)
+		}
+		if c.desc != "" {
+			assert.Equal(t, c.desc, c.m.String())
+		}
+	}
+
+	assert.Panics(t, func() { Regex("[") })
+}
+
+func TestMatchArgs(t *testing.T) {
+	m := []ArgMatcher{Equal("key"), Rest(IntRange(0, 10))}
+	assert.True(t, matchArgs([]string{"key"}, m))
+	assert.True(t, matchArgs([]string{"key", "1", "2"}, m))
+	assert.False(t, matchArgs([]string{"key", "1", "20"}, m))
+	assert.False(t, matchArgs([]string{}, m))
+	assert.Equal(t, `"key" [0..10]...`, describeMatchers(m))
+
+	m = []ArgMatcher{Equal("key"), AnyArg()}
+	assert.True(t, matchArgs([]string{"key", "x"}, m))
+	assert.False(t, matchArgs([]string{"key"}, m))
+	assert.False(t, matchArgs([]string{"key", "x", "y"}, m))
+}
+
+func TestRedigoArgMatchers(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.Expect("SET").WithArgMatchers(
+		Prefix("session:"),
+		JSONEq(`{"id": 1}`),
+		CaseInsensitive("EX"),
+		IntRange(60, 3600),
+	).WillReturn("OK").Once()
+	s.Expect("DEL").WithArgMatchers(Rest(Glob("tmp:*"))).WillReturn(2).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("SET", "session:abc", `{ "id" : 1 }`, "ex", 120)
+	require.NoError(t, err)
+
+	n, err := redis.Int(red.Do("DEL", "tmp:1", "tmp:2"))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	require.NoError(t, s.ExpectationsWereMet())
+
+	_, err = red.Do("SET", "session:abc", `{"id":2}`, "ex", 120)
+	require.Error(t, err)
+
+	err = s.ExpectationsWereMet()
+	require.EqualError(t, err, `command SET session:abc {"id":2} ex 120 is called but not expected, `+
+		`expected one of: SET "session:"* json({"id": 1}) i"EX" [60..3600]`+"\n")
+}
+
+func TestMatchAnyOrder(t *testing.T) {
+	m := []ArgMatcher{Equal("key"), AnyOrder("a", "b", "b")}
+	assert.True(t, matchArgs([]string{"key", "b", "a", "b"}, m))
+	assert.True(t, matchArgs([]string{"key", "a", "b", "b"}, m))
+	assert.False(t, matchArgs([]string{"key", "a", "a", "b"}, m))
+	assert.False(t, matchArgs([]string{"key", "a", "b"}, m))
+	assert.False(t, matchArgs([]string{"key"}, m))
+	assert.Equal(t, `"key" anyorder("a" "b" "b")`, describeMatchers(m))
+
+	m = []ArgMatcher{Equal("key"), AnyOrderPairs("f1", "v1", "f2", "v2")}
+	assert.True(t, matchArgs([]string{"key", "f2", "v2", "f1", "v1"}, m))
+	assert.False(t, matchArgs([]string{"key", "f2", "v1", "f1", "v2"}, m))
+	assert.False(t, matchArgs([]string{"key", "v1", "f1", "f2", "v2"}, m))
+	assert.False(t, matchArgs([]string{"key", "f1", "v1"}, m))
+	assert.Equal(t, `"key" anyorder("f1" "v1", "f2" "v2")`, describeMatchers(m))
+
+	assert.True(t, AnyOrder("a").Match("a"))
+	assert.False(t, AnyOrderPairs("a", "b").Match("a"))
+	assert.False(t, matchArgs([]string{"a", "b", "c"}, []ArgMatcher{AnyOrderPairs("a", "b", "c")}))
+	assert.False(t, matchArgs(nil, []ArgMatcher{Equal("a"), Equal("b"), Rest(AnyArg())}))
+}
+
+func TestRedigoAnyOrderHelpers(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectHSet("hash", "f1", "v1", false, "f2", "v2", "f3", "v3").Once()
+	s.ExpectSAdd(3, "set", "a", "b", "c").Once()
+	s.ExpectMSet("k1", "v1", "k2", "v2").Once()
+	s.ExpectDel(2, "k1", "k2").Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	n, err := redis.Int(red.Do("HSET", "hash", "f3", "v3", "f1", "v1", "f2", "v2"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	n, err = redis.Int(red.Do("SADD", "set", "c", "a", "b"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	st, err := redis.String(red.Do("MSET", "k2", "v2", "k1", "v1"))
+	require.NoError(t, err)
+	require.Equal(t, "OK", st)
+
+	n, err = redis.Int(red.Do("DEL", "k2", "k1"))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
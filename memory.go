@@ -0,0 +1,286 @@
+package redimock
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// memoryNetwork is the network name of the in-memory listener
+const memoryNetwork = "memory"
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return memoryNetwork
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
+
+// memoryListener is a listener without any socket, each dial makes a pair of
+// memoryConn and the server side is returned in Accept
+type memoryListener struct {
+	addr  memoryAddr
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newMemoryListener(addr string) *memoryListener {
+	if addr == "" {
+		addr = "redimock"
+	}
+	return &memoryListener{
+		addr:  memoryAddr(addr),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *memoryListener) dial(ctx context.Context) (net.Conn, error) {
+	server, client := newMemoryPipe(l.addr)
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+	case <-ctx.Done():
+		_ = server.Close()
+		_ = client.Close()
+		return nil, ctx.Err()
+	}
+	_ = server.Close()
+	_ = client.Close()
+	return nil, &net.OpError{Op: "dial", Net: memoryNetwork, Addr: l.addr, Err: net.ErrClosed}
+}
+
+// Dial connects to the server, see DialContext
+func (s *Server) Dial(network, addr string) (net.Conn, error) {
+	return s.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the server, the network and addr are ignored and the
+// server address is used. it can be used as the dialer of the clients, like
+// redis.DialNetDial in redigo or the Dialer in go-redis options. for the
+// WithNetwork("memory") servers, it is the only way to connect. with TLS the
+// connection is wrapped with TLSClientConfig, so the client must not enable TLS
+// again. if the certificate is in the config of WithTLS, the connection is not
+// wrapped and the client must do the handshake with its own config
+func (s *Server) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	s.lock.RLock()
+	mem, listener := s.memory, s.listener
+	s.lock.RUnlock()
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch {
+	case mem != nil:
+		conn, err = mem.dial(ctx)
+	case listener == nil:
+		return nil, ErrServerClosed
+	default:
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, listener.Addr().Network(), listener.Addr().String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config := s.TLSClientConfig(); config != nil {
+		return tls.Client(conn, config), nil
+	}
+	return conn, nil
+}
+
+// memoryBuffer is one direction of the in-memory connection. the writes never
+// block, like a socket with a large buffer, so a client can write a big
+// pipeline while the server is replying to the first commands
+type memoryBuffer struct {
+	lock     sync.Mutex
+	data     bytes.Buffer
+	deadline time.Time
+	// writeClosed is set when the writer is closed, the reader gets io.EOF after
+	// the data. readClosed is set when the reader is closed
+	writeClosed bool
+	readClosed  bool
+	changed     chan struct{}
+}
+
+// broadcast wakes up the waiting reader, the lock must be held by the caller
+func (b *memoryBuffer) broadcast() {
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+func (b *memoryBuffer) read(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for {
+		switch {
+		case b.readClosed:
+			return 0, net.ErrClosed
+		case b.data.Len() > 0:
+			return b.data.Read(p)
+		case b.writeClosed:
+			return 0, io.EOF
+		case !b.deadline.IsZero() && !time.Now().Before(b.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		if b.changed == nil {
+			b.changed = make(chan struct{})
+		}
+		ch, deadline := b.changed, b.deadline
+		b.lock.Unlock()
+		waitDeadline(ch, deadline)
+		b.lock.Lock()
+	}
+}
+
+// waitDeadline waits for the channel or the deadline, a zero deadline is no deadline
+func waitDeadline(ch <-chan struct{}, deadline time.Time) {
+	if deadline.IsZero() {
+		<-ch
+		return
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-ch:
+	case <-t.C:
+	}
+}
+
+func (b *memoryBuffer) write(p []byte, deadline time.Time) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch {
+	case b.writeClosed:
+		return 0, net.ErrClosed
+	case b.readClosed:
+		return 0, io.ErrClosedPipe
+	case !deadline.IsZero() && !time.Now().Before(deadline):
+		return 0, os.ErrDeadlineExceeded
+	}
+	b.broadcast()
+	return b.data.Write(p)
+}
+
+func (b *memoryBuffer) setDeadline(t time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.deadline = t
+	b.broadcast()
+}
+
+func (b *memoryBuffer) closeRead() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.readClosed = true
+	b.data.Reset()
+	b.broadcast()
+}
+
+func (b *memoryBuffer) closeWrite() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.writeClosed = true
+	b.broadcast()
+}
+
+// memoryConn is one side of the in-memory connection, it reads from in and
+// writes to out, which is the in of the other side
+type memoryConn struct {
+	addr    memoryAddr
+	in, out *memoryBuffer
+
+	lock          sync.Mutex
+	writeDeadline time.Time
+	once          sync.Once
+}
+
+func newMemoryPipe(addr memoryAddr) (*memoryConn, *memoryConn) {
+	a, b := &memoryBuffer{}, &memoryBuffer{}
+	return &memoryConn{addr: addr, in: a, out: b}, &memoryConn{addr: addr, in: b, out: a}
+}
+
+func (c *memoryConn) Read(p []byte) (int, error) {
+	return c.in.read(p)
+}
+
+func (c *memoryConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	deadline := c.writeDeadline
+	c.lock.Unlock()
+
+	return c.out.write(p, deadline)
+}
+
+func (c *memoryConn) Close() error {
+	c.once.Do(func() {
+		c.in.closeRead()
+		c.out.closeWrite()
+	})
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+func (c *memoryConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,123 @@
+package redimock
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket(t *testing.T) {
+	s, err := NewServer(context.Background(), "", WithNetwork("unix"))
+	require.NoError(t, err)
+	s.ExpectPing().Times(2)
+
+	addr := s.NetAddr()
+	require.Equal(t, "unix", addr.Network())
+	require.Nil(t, s.Addr())
+	_, err = os.Stat(addr.String())
+	require.NoError(t, err)
+
+	red, err := redis.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Restart(0))
+	red, err = redis.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	require.NoError(t, s.ExpectationsWereMet())
+	require.NoError(t, s.Close())
+	_, err = os.Stat(filepath.Dir(addr.String()))
+	require.True(t, os.IsNotExist(err), "the temporary directory must be removed")
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	s, err := NewServer(context.Background(), path, WithNetwork("unix"))
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, path, s.NetAddr().String())
+}
+
+func TestTestServerNetwork(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("unix"))
+	s.ExpectPing().Once()
+
+	red, err := redis.Dial("unix", s.NetAddr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	s = NewTestServer(t, WithNetwork("tcp4"))
+	require.Equal(t, "127.0.0.1", s.Addr().IP.String())
+}
+
+func TestInvalidNetwork(t *testing.T) {
+	_, err := NewServer(context.Background(), "", WithNetwork("udp"))
+	require.Error(t, err)
+}
+
+func TestMemoryNetwork(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+	s.ExpectPing().Times(3)
+
+	require.Nil(t, s.Addr())
+	require.Equal(t, "memory", s.NetAddr().Network())
+
+	red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	cl := goredis.NewClient(&goredis.Options{
+		Dialer: func() (net.Conn, error) {
+			return s.Dial("", "")
+		},
+	})
+	defer cl.Close()
+	require.NoError(t, cl.Ping().Err())
+
+	require.NoError(t, s.Stop())
+	_, err = s.Dial("", "")
+	require.Error(t, err)
+	require.NoError(t, s.Start())
+
+	red, err = redis.Dial("", "", redis.DialNetDial(s.Dial))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+}
+
+func TestDialContext(t *testing.T) {
+	s := NewTestServer(t)
+	s.ExpectPing().Once()
+
+	conn, err := s.DialContext(context.Background(), "", "")
+	require.NoError(t, err)
+	red := redis.NewConn(conn, time.Second, time.Second)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	s = NewTestServer(t, WithNetwork("memory"))
+	require.NoError(t, s.Stop())
+	ctx, cnl := context.WithCancel(context.Background())
+	cnl()
+	_, err = s.DialContext(ctx, "", "")
+	require.Error(t, err)
+}
@@ -2,12 +2,17 @@ package redimock
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -23,23 +28,71 @@ type (
 	BulkString string
 	// Error is the redis error type
 	Error string
+	// Null is the RESP3 null, in RESP2 it is written as a nil bulk string, same as nil
+	Null struct{}
+	// Double is the RESP3 double type, in RESP2 it is written as a bulk string
+	Double float64
+	// Boolean is the RESP3 boolean type, in RESP2 it is written as integer 1 or 0
+	Boolean bool
+	// BigNumber is the RESP3 big number in decimal representation, in RESP2 it is
+	// written as a bulk string
+	BigNumber string
+	// Map is the RESP3 map type as a flat list of key and values, in RESP2 it is
+	// written as an array, like the HGETALL result
+	Map []interface{}
+	// Set is the RESP3 set type, in RESP2 it is written as an array
+	Set []interface{}
+	// Push is the RESP3 out of band push data, in RESP2 it is written as an array
+	Push []interface{}
+	// SimpleString is the redis simple string, same as string
+	SimpleString string
+	// Int64 is the redis integer
+	Int64 int64
+	// Array is the redis array, it can be nested and any slice is also written as an array
+	Array []interface{}
+	// NullArray is the nil array (*-1), in RESP3 it is the dedicated null type
+	NullArray struct{}
+	// EmptyArray is the array with no element (*0)
+	EmptyArray struct{}
+	// Raw is written to the connection as is without any validation, it can be
+	// used for malformed responses
+	Raw []byte
 )
 
-// client always sends arrays with bulk strings
+// Verbatim is the RESP3 verbatim string, Format is a three letter type like
+// txt or mkd and the default is txt. in RESP2 only the text is written as a bulk string
+type Verbatim struct {
+	Format string
+	Text   string
+}
+
+// Attribute is the RESP3 attribute type, the attributes are written before the
+// value. in RESP2 only the value is written
+type Attribute struct {
+	Attrs Map
+	Value interface{}
+}
+
+// client usually sends arrays with bulk strings, anything else is an inline
+// command. if the reader is already a *bufio.Reader it is used as is, so the
+// buffered data is not lost between calls
 func readArray(r io.Reader) ([]string, error) {
-	rd := bufio.NewReader(r)
+	rd, ok := r.(*bufio.Reader)
+	if !ok {
+		rd = bufio.NewReader(r)
+	}
 	line, err := rd.ReadString('\n')
 	if err != nil {
 		return nil, err
 	}
-	if len(line) < 3 {
-		return nil, ErrProtocol
-	}
 
 	switch line[0] {
 	default:
-		return nil, ErrProtocol
+		return splitInline(strings.TrimRight(line, "\r\n"))
 	case '*':
+		if len(line) < 3 {
+			return nil, ErrProtocol
+		}
 		l, err := strconv.Atoi(line[1 : len(line)-2])
 		if err != nil {
 			return nil, ErrProtocol
@@ -57,6 +110,107 @@ func readArray(r io.Reader) ([]string, error) {
 	}
 }
 
+// splitInline splits an inline command the same way redis does it. arguments are
+// separated by spaces and can be quoted. double quotes support the escape
+// sequences like \n and \xff, single quotes support only \'. empty line means
+// no command
+func splitInline(line string) ([]string, error) {
+	var (
+		fields []string
+		i      int
+	)
+	for {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return fields, nil
+		}
+
+		var (
+			current []byte
+			inDQ    bool
+			inSQ    bool
+			done    bool
+		)
+		for !done {
+			if i >= len(line) {
+				if inDQ || inSQ {
+					// unbalanced quotes
+					return nil, ErrProtocol
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDQ:
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					current = append(current, byte(b))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if c == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, ErrProtocol
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			case inSQ:
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, ErrProtocol
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			default:
+				switch {
+				case isInlineSpace(c):
+					done = true
+				case c == '"':
+					inDQ = true
+				case c == '\'':
+					inSQ = true
+				default:
+					current = append(current, c)
+				}
+			}
+			i++
+		}
+		fields = append(fields, string(current))
+	}
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
 func readString(rd *bufio.Reader) (string, error) {
 	line, err := rd.ReadString('\n')
 	if err != nil {
@@ -100,40 +254,275 @@ func readString(rd *bufio.Reader) (string, error) {
 	}
 }
 
-func writeF(w io.Writer, s string, args ...interface{}) error {
-	str := fmt.Sprintf(s, args...)
-	_, err := fmt.Fprintf(w, str)
+// Protocol versions supported by the server, the client can switch between them
+// using the HELLO command
+const (
+	Resp2 = 2
+	Resp3 = 3
+)
+
+// respWriter writes the responses using the protocol version negotiated by the
+// client. everything is buffered and written to the underlying writer with
+// a single call in flush. the zero value writes RESP2
+type respWriter struct {
+	w       io.Writer
+	proto   int
+	buf     bytes.Buffer
+	flushes int
+}
+
+func (rw *respWriter) resp3() bool {
+	return rw.proto == Resp3
+}
+
+// writeLine writes a single line with the type prefix, the data is written as is
+func (rw *respWriter) writeLine(prefix byte, s string) error {
+	rw.buf.WriteByte(prefix)
+	rw.buf.WriteString(s)
+	rw.buf.WriteString("\r\n")
+	return nil
+}
+
+// flush writes the buffered responses to the underlying writer
+func (rw *respWriter) flush() error {
+	if rw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := rw.w.Write(rw.buf.Bytes())
+	rw.buf.Reset()
+	rw.flushes++
+	return err
+}
+
+// flushSlow writes the buffered responses to the underlying writer slowly
+func (rw *respWriter) flushSlow(sw slowWrite) error {
+	if rw.buf.Len() == 0 {
+		return nil
+	}
+	err := sw.write(rw.w, rw.buf.Bytes())
+	rw.buf.Reset()
+	rw.flushes++
 	return err
 }
 
+// slowWrite is the configuration for writing the responses slowly, in chunks
+// with a pause between them or with a stall after some bytes
+type slowWrite struct {
+	size    int
+	pause   time.Duration
+	stallAt int
+	stall   time.Duration
+	// abort stops the pauses, when the server is closed
+	abort <-chan struct{}
+}
+
+func (sw slowWrite) enabled() bool {
+	return sw.size > 0 || sw.stall > 0
+}
+
+func (sw slowWrite) write(w io.Writer, data []byte) error {
+	if sw.stall > 0 && sw.stallAt <= 0 && len(data) > 0 {
+		// stall before the first byte
+		if !sleep(sw.abort, sw.stall) {
+			return net.ErrClosed
+		}
+	}
+	var written int
+	for len(data) > 0 {
+		n := len(data)
+		if sw.size > 0 && n > sw.size {
+			n = sw.size
+		}
+		if sw.stall > 0 && written < sw.stallAt && written+n > sw.stallAt {
+			n = sw.stallAt - written
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			return err
+		}
+		data, written = data[n:], written+n
+		if len(data) == 0 {
+			break
+		}
+
+		d := sw.pause
+		if sw.stall > 0 && written == sw.stallAt {
+			d = sw.stall
+		}
+		if !sleep(sw.abort, d) {
+			return net.ErrClosed
+		}
+	}
+	return nil
+}
+
 // writeError try to write a redis error to output
-func writeError(w io.Writer, e Error) error {
-	return writeF(w, "-%s\r\n", toInline(string(e)))
+func (rw *respWriter) writeError(e Error) error {
+	return rw.writeLine('-', toInline(string(e)))
 }
 
 // writeSimpleString writes a redis inline string
-func writeSimpleString(w io.Writer, s string) error {
-	return writeF(w, "+%s\r\n", toInline(s))
+func (rw *respWriter) writeSimpleString(s string) error {
+	return rw.writeLine('+', toInline(s))
 }
 
 // writeBulkString writes a bulk string
-func writeBulkString(w io.Writer, s BulkString) error {
-	return writeF(w, "$%d\r\n%s\r\n", len(s), s)
+func (rw *respWriter) writeBulkString(s BulkString) error {
+	_ = rw.writeLine('$', strconv.Itoa(len(s)))
+	rw.buf.WriteString(string(s))
+	rw.buf.WriteString("\r\n")
+	return nil
 }
 
-// writeNull writes a redis string NULL
-func writeNull(w io.Writer) error {
-	return writeF(w, "$-1\r\n")
+// writeNull writes a redis string NULL, in RESP3 it is the dedicated null type
+func (rw *respWriter) writeNull() error {
+	if rw.resp3() {
+		return rw.writeLine('_', "")
+	}
+	return rw.writeLine('$', "-1")
 }
 
-// writeLen starts an array with the given length
-func writeLen(w io.Writer, n int) error {
-	return writeF(w, "*%d\r\n", n)
+// writeLen starts an aggregate type with the given prefix and length
+func (rw *respWriter) writeLen(prefix byte, n int) error {
+	return rw.writeLine(prefix, strconv.Itoa(n))
 }
 
 // writeInt writes an integer
-func writeInt(w io.Writer, i int) error {
-	return writeF(w, ":%d\r\n", i)
+func (rw *respWriter) writeInt(i int64) error {
+	return rw.writeLine(':', strconv.FormatInt(i, 10))
+}
+
+// writeUint writes an unsigned integer, redis integers are signed 64 bit so
+// bigger values are written as a big number
+func (rw *respWriter) writeUint(i uint64) error {
+	if i > math.MaxInt64 {
+		return rw.writeBigNumber(BigNumber(strconv.FormatUint(i, 10)))
+	}
+	return rw.writeInt(int64(i))
+}
+
+// writeNullArray writes a nil array, in RESP3 it is the dedicated null type
+func (rw *respWriter) writeNullArray() error {
+	if rw.resp3() {
+		return rw.writeNull()
+	}
+	return rw.writeLine('*', "-1")
+}
+
+// writeRaw writes the data as is, without any change
+func (rw *respWriter) writeRaw(r Raw) error {
+	rw.buf.Write(r)
+	return nil
+}
+
+// writeFragments writes each fragment with a separate write call, the already
+// buffered data goes with the first fragment
+func (rw *respWriter) writeFragments(f Fragments) error {
+	for i := range f {
+		rw.buf.Write(f[i])
+		if err := rw.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDouble writes a double, in RESP2 it is a bulk string
+func (rw *respWriter) writeDouble(d Double) error {
+	str := formatDouble(float64(d))
+	if rw.resp3() {
+		return rw.writeLine(',', str)
+	}
+	return rw.writeBulkString(BulkString(str))
+}
+
+// writeBoolean writes a boolean, in RESP2 it is the integer 1 or 0
+func (rw *respWriter) writeBoolean(b Boolean) error {
+	if rw.resp3() {
+		if b {
+			return rw.writeLine('#', "t")
+		}
+		return rw.writeLine('#', "f")
+	}
+	if b {
+		return rw.writeInt(1)
+	}
+	return rw.writeInt(0)
+}
+
+// writeBigNumber writes a big number, in RESP2 it is a bulk string
+func (rw *respWriter) writeBigNumber(n BigNumber) error {
+	if rw.resp3() {
+		return rw.writeLine('(', string(n))
+	}
+	return rw.writeBulkString(BulkString(n))
+}
+
+// writeVerbatim writes a verbatim string, in RESP2 it is a bulk string without the format
+func (rw *respWriter) writeVerbatim(v Verbatim) error {
+	if !rw.resp3() {
+		return rw.writeBulkString(BulkString(v.Text))
+	}
+	format := v.Format
+	if format == "" {
+		format = "txt"
+	}
+	if len(format) != 3 {
+		return fmt.Errorf("invalid verbatim format: %q", format)
+	}
+	_ = rw.writeLine('=', strconv.Itoa(len(v.Text)+4))
+	rw.buf.WriteString(format)
+	rw.buf.WriteByte(':')
+	rw.buf.WriteString(v.Text)
+	rw.buf.WriteString("\r\n")
+	return nil
+}
+
+// writeMap writes a map, in RESP2 it is a flat array of key and values
+func (rw *respWriter) writeMap(prefix byte, m Map) error {
+	if len(m)%2 != 0 {
+		return fmt.Errorf("invalid map, odd number of elements: %d", len(m))
+	}
+	if !rw.resp3() {
+		return rw.writeArray('*', m)
+	}
+	if err := rw.writeLen(prefix, len(m)/2); err != nil {
+		return err
+	}
+	return rw.write(m...)
+}
+
+// writeAttribute writes the attributes before the actual value, in RESP2 the
+// attributes are dropped
+func (rw *respWriter) writeAttribute(a Attribute) error {
+	if rw.resp3() {
+		if err := rw.writeMap('|', a.Attrs); err != nil {
+			return err
+		}
+	}
+	return rw.writeSingle(a.Value)
+}
+
+// writeArray writes an aggregate type, set and push are arrays in RESP2
+func (rw *respWriter) writeArray(prefix byte, arr []interface{}) error {
+	if !rw.resp3() {
+		prefix = '*'
+	}
+	if err := rw.writeLen(prefix, len(arr)); err != nil {
+		return err
+	}
+	return rw.write(arr...)
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
 }
 
 func toInline(s string) string {
@@ -145,49 +534,120 @@ func toInline(s string) string {
 	}, s)
 }
 
-func tryWriteArray(w io.Writer, t interface{}) error {
+func (rw *respWriter) tryWriteReflect(t interface{}) error {
 	// Now nasty reflection
 	v := reflect.ValueOf(t)
-	if v.Kind() != reflect.Slice {
-		return fmt.Errorf("invalid type: %T", t)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		args := make([]interface{}, v.Len())
+		for i := range args {
+			args[i] = v.Index(i).Interface()
+		}
+		return rw.writeArray('*', args)
+	case reflect.Map:
+		// sort the keys, so the result is the same every time
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		m := make(Map, 0, len(keys)*2)
+		for _, k := range keys {
+			m = append(m, toBulk(k.Interface()), toBulk(v.MapIndex(k).Interface()))
+		}
+		return rw.writeMap('%', m)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rw.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rw.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rw.writeDouble(Double(v.Float()))
+	case reflect.Bool:
+		return rw.writeBoolean(Boolean(v.Bool()))
+	case reflect.String:
+		return rw.writeSimpleString(v.String())
 	}
 
-	l := v.Len()
-	if err := writeLen(w, l); err != nil {
-		return err
-	}
+	return fmt.Errorf("invalid type: %T", t)
+}
 
-	args := make([]interface{}, l)
-	for i := range args {
-		args[i] = v.Index(i).Interface()
+// toBulk converts the strings inside the maps to bulk string, like redis does
+func toBulk(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return BulkString(t)
+	case []byte:
+		return BulkString(t)
 	}
-
-	return write(w, args...)
+	return v
 }
 
-func writeSingle(w io.Writer, arg interface{}) error {
+func (rw *respWriter) writeSingle(arg interface{}) error {
 	// first the easy way, no reflection
 	switch t := arg.(type) {
 	case Error:
 		// TODO : make sure its a one-liner
-		return writeError(w, t)
+		return rw.writeError(t)
+	case error:
+		return rw.writeError(Error(t.Error()))
 	case BulkString:
-		return writeBulkString(w, t)
+		return rw.writeBulkString(t)
+	case []byte:
+		return rw.writeBulkString(BulkString(t))
+	case Raw:
+		return rw.writeRaw(t)
+	case Fragments:
+		return rw.writeFragments(t)
 	case int:
-		return writeInt(w, t)
+		return rw.writeInt(int64(t))
+	case int64:
+		return rw.writeInt(t)
+	case Int64:
+		return rw.writeInt(int64(t))
+	case uint64:
+		return rw.writeUint(t)
+	case time.Duration:
+		return rw.writeInt(int64(t / time.Second))
 	case string:
-		return writeSimpleString(w, t)
-	case nil:
-		return writeNull(w)
+		return rw.writeSimpleString(t)
+	case SimpleString:
+		return rw.writeSimpleString(string(t))
+	case nil, Null:
+		return rw.writeNull()
+	case NullArray:
+		return rw.writeNullArray()
+	case EmptyArray:
+		return rw.writeLen('*', 0)
+	case Array:
+		return rw.writeArray('*', t)
+	case float64:
+		return rw.writeDouble(Double(t))
+	case Double:
+		return rw.writeDouble(t)
+	case bool:
+		return rw.writeBoolean(Boolean(t))
+	case Boolean:
+		return rw.writeBoolean(t)
+	case BigNumber:
+		return rw.writeBigNumber(t)
+	case Verbatim:
+		return rw.writeVerbatim(t)
+	case Map:
+		return rw.writeMap('%', t)
+	case Set:
+		return rw.writeArray('~', t)
+	case Push:
+		return rw.writeArray('>', t)
+	case Attribute:
+		return rw.writeAttribute(t)
 	default:
-		return tryWriteArray(w, t)
+		return rw.tryWriteReflect(t)
 	}
 
 }
 
-func write(w io.Writer, args ...interface{}) error {
+func (rw *respWriter) write(args ...interface{}) error {
 	for i := range args {
-		if err := writeSingle(w, args[i]); err != nil {
+		if err := rw.writeSingle(args[i]); err != nil {
 			return err
 		}
 	}
@@ -195,6 +655,15 @@ func write(w io.Writer, args ...interface{}) error {
 	return nil
 }
 
+// write writes the arguments using RESP2
+func write(w io.Writer, args ...interface{}) error {
+	rw := &respWriter{w: w, proto: Resp2}
+	if err := rw.write(args...); err != nil {
+		return err
+	}
+	return rw.flush()
+}
+
 // equalArgs try to compare arguments
 // TODO : add more functionality, like case insensitive or order
 func equalArgs(in []string, expectd []string) bool {
@@ -3,10 +3,13 @@ package redimock
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,14 +45,45 @@ func TestReadArray(t *testing.T) {
 		},
 		{
 			payload: "\r\n",
-			err:     ErrProtocol,
 		},
 		{
 			payload: "*NO\r\n",
 			err:     ErrProtocol,
 		},
+		{
+			payload: "*\n",
+			err:     ErrProtocol,
+		},
 		{
 			payload: "&10\r\n",
+			res:     []string{"&10"},
+		},
+		{
+			payload: "PING\r\n",
+			res:     []string{"PING"},
+		},
+		{
+			payload: "  SET   key value\n",
+			res:     []string{"SET", "key", "value"},
+		},
+		{
+			payload: "SET key \"hello world\" 'it\\'s'\r\n",
+			res:     []string{"SET", "key", "hello world", "it's"},
+		},
+		{
+			payload: "SET key \"a\\tb\\x41\\\"\" ''\r\n",
+			res:     []string{"SET", "key", "a\tbA\"", ""},
+		},
+		{
+			payload: "SET key \"value\r\n",
+			err:     ErrProtocol,
+		},
+		{
+			payload: "SET key 'value\r\n",
+			err:     ErrProtocol,
+		},
+		{
+			payload: "SET key \"value\"x\r\n",
 			err:     ErrProtocol,
 		},
 	} {
@@ -135,6 +169,14 @@ func TestReadString(t *testing.T) {
 	}
 }
 
+func writeProto(w io.Writer, proto int, args ...interface{}) error {
+	rw := &respWriter{w: w, proto: proto}
+	if err := rw.write(args...); err != nil {
+		return err
+	}
+	return rw.flush()
+}
+
 type failWriter int
 
 func (failWriter) Write(p []byte) (n int, err error) {
@@ -143,7 +185,8 @@ func (failWriter) Write(p []byte) (n int, err error) {
 
 func TestProtoWrite(t *testing.T) {
 	w := &bytes.Buffer{}
-	assert.Error(t, write(w, map[string]string{}))
+	assert.Error(t, write(w, struct{}{}))
+	assert.Error(t, write(w, []interface{}{make(chan int)}))
 	assert.Error(t, write(failWriter(0), []int{1, 2, 3}))
 }
 
@@ -152,3 +195,147 @@ func TestCompareArgs(t *testing.T) {
 	assert.False(t, equalArgs([]string{"a", "b", "c"}, []string{"b", "c"}))
 	assert.True(t, equalArgs([]string{"a", "b", "c"}, []string{"a", "b", "c"}))
 }
+
+func TestProtoWriteResp3(t *testing.T) {
+	type cas struct {
+		value interface{}
+		resp2 string
+		resp3 string
+	}
+	for _, c := range []cas{
+		{value: nil, resp2: "$-1\r\n", resp3: "_\r\n"},
+		{value: Null{}, resp2: "$-1\r\n", resp3: "_\r\n"},
+		{value: Double(1.5), resp2: "$3\r\n1.5\r\n", resp3: ",1.5\r\n"},
+		{value: Double(math.Inf(-1)), resp2: "$4\r\n-inf\r\n", resp3: ",-inf\r\n"},
+		{value: Boolean(true), resp2: ":1\r\n", resp3: "#t\r\n"},
+		{value: Boolean(false), resp2: ":0\r\n", resp3: "#f\r\n"},
+		{
+			value: BigNumber("3492890328409238509324850943850943825024385"),
+			resp2: "$43\r\n3492890328409238509324850943850943825024385\r\n",
+			resp3: "(3492890328409238509324850943850943825024385\r\n",
+		},
+		{value: Verbatim{Text: "hello"}, resp2: "$5\r\nhello\r\n", resp3: "=9\r\ntxt:hello\r\n"},
+		{value: Verbatim{Format: "mkd", Text: "# hi"}, resp2: "$4\r\n# hi\r\n", resp3: "=8\r\nmkd:# hi\r\n"},
+		{
+			value: Map{BulkString("k"), 1, "s", nil},
+			resp2: "*4\r\n$1\r\nk\r\n:1\r\n+s\r\n$-1\r\n",
+			resp3: "%2\r\n$1\r\nk\r\n:1\r\n+s\r\n_\r\n",
+		},
+		{value: Set{1, 2}, resp2: "*2\r\n:1\r\n:2\r\n", resp3: "~2\r\n:1\r\n:2\r\n"},
+		{
+			value: Push{BulkString("message"), BulkString("ch")},
+			resp2: "*2\r\n$7\r\nmessage\r\n$2\r\nch\r\n",
+			resp3: ">2\r\n$7\r\nmessage\r\n$2\r\nch\r\n",
+		},
+		{
+			value: Attribute{Attrs: Map{"ttl", 10}, Value: BulkString("v")},
+			resp2: "$1\r\nv\r\n",
+			resp3: "|1\r\n+ttl\r\n:10\r\n$1\r\nv\r\n",
+		},
+		{
+			value: []interface{}{Boolean(true), []interface{}{Double(2)}},
+			resp2: "*2\r\n:1\r\n*1\r\n$1\r\n2\r\n",
+			resp3: "*2\r\n#t\r\n*1\r\n,2\r\n",
+		},
+	} {
+		w := &bytes.Buffer{}
+		assert.NoError(t, writeProto(w, Resp2, c.value))
+		assert.Equal(t, c.resp2, w.String())
+
+		w = &bytes.Buffer{}
+		assert.NoError(t, writeProto(w, Resp3, c.value))
+		assert.Equal(t, c.resp3, w.String())
+	}
+
+	assert.Error(t, writeProto(&bytes.Buffer{}, Resp3, Map{"odd"}))
+	assert.Error(t, writeProto(&bytes.Buffer{}, Resp3, Verbatim{Format: "text", Text: "x"}))
+}
+
+func TestProtoWriteGoValues(t *testing.T) {
+	type cas struct {
+		value interface{}
+		resp2 string
+		resp3 string
+	}
+	for _, c := range []cas{
+		{value: int64(-10), resp2: ":-10\r\n"},
+		{value: Int64(1 << 40), resp2: ":1099511627776\r\n"},
+		{value: int32(7), resp2: ":7\r\n"},
+		{value: uint8(7), resp2: ":7\r\n"},
+		{value: uint64(10), resp2: ":10\r\n"},
+		{value: uint64(math.MaxUint64), resp2: "$20\r\n18446744073709551615\r\n", resp3: "(18446744073709551615\r\n"},
+		{value: 2.5, resp2: "$3\r\n2.5\r\n", resp3: ",2.5\r\n"},
+		{value: float32(0.5), resp2: "$3\r\n0.5\r\n", resp3: ",0.5\r\n"},
+		{value: true, resp2: ":1\r\n", resp3: "#t\r\n"},
+		{value: []byte("bin\r\nary"), resp2: "$8\r\nbin\r\nary\r\n"},
+		{value: errors.New("ERR failed\nbadly"), resp2: "-ERR failed badly\r\n"},
+		{value: time.Minute, resp2: ":60\r\n"},
+		{value: SimpleString("OK"), resp2: "+OK\r\n"},
+		{value: NullArray{}, resp2: "*-1\r\n", resp3: "_\r\n"},
+		{value: EmptyArray{}, resp2: "*0\r\n"},
+		{value: Raw("+RAW\r\n"), resp2: "+RAW\r\n"},
+		{
+			value: Array{1, Array{BulkString("a"), nil}, EmptyArray{}},
+			resp2: "*3\r\n:1\r\n*2\r\n$1\r\na\r\n$-1\r\n*0\r\n",
+			resp3: "*3\r\n:1\r\n*2\r\n$1\r\na\r\n_\r\n*0\r\n",
+		},
+		{
+			value: map[string]string{"b": "2", "a": "1"},
+			resp2: "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+			resp3: "%2\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			value: map[string]int{"x": 1},
+			resp2: "*2\r\n$1\r\nx\r\n:1\r\n",
+			resp3: "%1\r\n$1\r\nx\r\n:1\r\n",
+		},
+	} {
+		if c.resp3 == "" {
+			c.resp3 = c.resp2
+		}
+		w := &bytes.Buffer{}
+		assert.NoError(t, writeProto(w, Resp2, c.value))
+		assert.Equal(t, c.resp2, w.String())
+
+		w = &bytes.Buffer{}
+		assert.NoError(t, writeProto(w, Resp3, c.value))
+		assert.Equal(t, c.resp3, w.String())
+	}
+}
+
+type countWriter struct {
+	bytes.Buffer
+	calls int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.calls++
+	return c.Buffer.Write(p)
+}
+
+func TestProtoWriteBinary(t *testing.T) {
+	bin := make([]byte, 256)
+	for i := range bin {
+		bin[i] = byte(i)
+	}
+	type cas struct {
+		value interface{}
+		res   string
+	}
+	for _, c := range []cas{
+		{value: BulkString("100%d %s %%"), res: "$11\r\n100%d %s %%\r\n"},
+		{value: "%v%!", res: "+%v%!\r\n"},
+		{value: Error("ERR %d"), res: "-ERR %d\r\n"},
+		{value: BulkString(bin), res: "$256\r\n" + string(bin) + "\r\n"},
+		{value: bin, res: "$256\r\n" + string(bin) + "\r\n"},
+		{
+			value: Array{BulkString("%!x"), bin},
+			res:   "*2\r\n$3\r\n%!x\r\n$256\r\n" + string(bin) + "\r\n",
+		},
+	} {
+		w := &countWriter{}
+		assert.NoError(t, write(w, c.value))
+		assert.Equal(t, 1, w.calls)
+		assert.Equal(t, c.res, w.String())
+	}
+}
@@ -0,0 +1,176 @@
+package redimock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are meant for go test -race, they use the server from many
+// goroutines at the same time
+
+func TestConcurrentExpect(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+
+	const workers, commands = 8, 20
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+			if !assertNoError(t, err) {
+				return
+			}
+			defer red.Close()
+			for i := 0; i < commands; i++ {
+				key := fmt.Sprintf("key:%d:%d", w, i)
+				// registered while the other connections are served
+				s.ExpectGet(key, true, key).Once()
+				v, err := redis.String(red.Do("GET", key))
+				if !assertNoError(t, err) {
+					return
+				}
+				if v != key {
+					t.Errorf("expected %q got %q", key, v)
+				}
+				_ = s.ExpectationsWereMet()
+				_ = s.Calls()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	require.NoError(t, s.ExpectationsWereMet())
+	require.Len(t, s.Calls(), workers*commands)
+}
+
+func TestConcurrentExpectBuilder(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+	// the unexpected commands are expected here, so no NewTestServer
+	s, err := NewServer(ctx, "", WithNetwork("memory"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	red, err := redis.Dial("", "", redis.DialNetDial(s.Dial), redis.DialReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer red.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		for {
+			v, err := redis.String(red.Do("GET", "key"))
+			if _, ok := err.(redis.Error); ok {
+				// not expected yet
+				continue
+			}
+			if err == nil && v != "value" {
+				err = fmt.Errorf("expected %q got %q", "value", v)
+			}
+			result <- err
+			return
+		}
+	}()
+	_, err = s.WaitForCommand(ctx, "GET")
+	require.NoError(t, err)
+
+	// the command is sent while the expectation is half built
+	cmd := s.Expect("GET").WithArgs("key")
+	n := len(s.Calls())
+	require.Eventually(t, func() bool {
+		return len(s.Calls()) > n+1
+	}, time.Second, time.Millisecond)
+	cmd.WillReturn("value").Once()
+
+	require.NoError(t, <-result)
+	require.Len(t, cmd.Calls(), 1)
+}
+
+func TestConcurrentCount(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+
+	const workers, commands = 8, 10
+	first := s.Expect("INCR").WithArgs("counter").WillReturn(1).Times(workers * commands / 2)
+	second := s.Expect("INCR").WithArgs("counter").WillReturn(2).Times(workers * commands / 2)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+			if !assertNoError(t, err) {
+				return
+			}
+			defer red.Close()
+			for i := 0; i < commands; i++ {
+				_, err := red.Do("INCR", "counter")
+				if !assertNoError(t, err) {
+					return
+				}
+			}
+		}()
+	}
+
+	// the builders and the getters are safe while serving
+	for i := 0; i < commands; i++ {
+		_ = first.String()
+		_ = second.Calls()
+		s.ExpectPing().WithDelay(0).Any()
+	}
+	wg.Wait()
+
+	require.NoError(t, s.ExpectationsWereMet())
+	require.Len(t, first.Calls(), workers*commands/2)
+	require.Len(t, second.Calls(), workers*commands/2)
+}
+
+func TestConcurrentSequence(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+	s.MatchExpectationsInOrderPerConnection(true)
+
+	const workers = 8
+	s.Expect("MULTI").WillReturn("OK").Times(workers)
+	s.Expect("EXEC").WillReturn([]interface{}{}).Times(workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+			if !assertNoError(t, err) {
+				return
+			}
+			defer red.Close()
+			_, err = red.Do("MULTI")
+			assertNoError(t, err)
+			_, err = red.Do("EXEC")
+			assertNoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+	require.NoError(t, s.Shutdown(ctx))
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+// assertNoError is require.NoError for the other goroutines
+func assertNoError(t *testing.T, err error) bool {
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	return true
+}
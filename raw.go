@@ -0,0 +1,87 @@
+package redimock
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// The functions in this file build malformed responses, they are useful for
+// testing the client behavior when the server is not behaving. the result is
+// written to the connection as is, so the client probably ends up in a broken
+// state, it is better to use them with CloseConnection.
+
+// Fragments is a response that is written to the connection with one write
+// call for each fragment, to simulate a response split across TCP packets
+type Fragments []Raw
+
+// Split splits the raw response into fragments with at most size bytes
+func Split(r Raw, size int) Fragments {
+	if size <= 0 {
+		size = 1
+	}
+	var res Fragments
+	for len(r) > size {
+		res = append(res, r[:size])
+		r = r[size:]
+	}
+	return append(res, r)
+}
+
+// TruncatedBulkString is a bulk string with the correct length header but
+// only the first n bytes of the data, without the final \r\n
+func TruncatedBulkString(s string, n int) Raw {
+	if n > len(s) {
+		n = len(s)
+	}
+	return Raw("$" + strconv.Itoa(len(s)) + "\r\n" + s[:n])
+}
+
+// WrongLengthBulkString is a bulk string with the given length header instead
+// of the real length of the data
+func WrongLengthBulkString(s string, length int) Raw {
+	return Raw("$" + strconv.Itoa(length) + "\r\n" + s + "\r\n")
+}
+
+// WrongLengthArray is an array header with the given length followed by the
+// elements, the length is not checked against the elements
+func WrongLengthArray(length int, elements ...interface{}) (Raw, error) {
+	body, err := Encode(Resp2, elements...)
+	if err != nil {
+		return nil, err
+	}
+	return append(Raw("*"+strconv.Itoa(length)+"\r\n"), body...), nil
+}
+
+// MissingCRLF is a simple string without the final \r\n
+func MissingCRLF(s string) Raw {
+	return Raw("+" + s)
+}
+
+// BareLF is a simple string terminated with \n instead of \r\n
+func BareLF(s string) Raw {
+	return Raw("+" + s + "\n")
+}
+
+// UnknownType is a line with an invalid type byte
+func UnknownType(typ byte, s string) Raw {
+	return Raw(string(typ) + s + "\r\n")
+}
+
+// InvalidInteger is an integer response with invalid number
+func InvalidInteger(s string) Raw {
+	return Raw(":" + s + "\r\n")
+}
+
+// Encode returns the encoded response for the values in the given protocol
+// version, it is useful to build a malformed response from a valid one
+func Encode(proto int, args ...interface{}) (Raw, error) {
+	buf := &bytes.Buffer{}
+	rw := &respWriter{w: buf, proto: proto}
+	if err := rw.write(args...); err != nil {
+		return nil, err
+	}
+	if err := rw.flush(); err != nil {
+		return nil, err
+	}
+	return Raw(buf.Bytes()), nil
+}
@@ -0,0 +1,105 @@
+package redimock
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawBuilders(t *testing.T) {
+	assert.Equal(t, Raw("$5\r\nhel"), TruncatedBulkString("hello", 3))
+	assert.Equal(t, Raw("$5\r\nhello"), TruncatedBulkString("hello", 10))
+	assert.Equal(t, Raw("$10\r\nhello\r\n"), WrongLengthBulkString("hello", 10))
+	assert.Equal(t, Raw("+OK"), MissingCRLF("OK"))
+	assert.Equal(t, Raw("+OK\n"), BareLF("OK"))
+	assert.Equal(t, Raw("!OK\r\n"), UnknownType('!', "OK"))
+	assert.Equal(t, Raw(":1.5\r\n"), InvalidInteger("1.5"))
+
+	arr, err := WrongLengthArray(3, 1, BulkString("a"))
+	require.NoError(t, err)
+	assert.Equal(t, Raw("*3\r\n:1\r\n$1\r\na\r\n"), arr)
+
+	_, err = WrongLengthArray(1, struct{}{})
+	assert.Error(t, err)
+
+	enc, err := Encode(Resp3, Map{"k", true})
+	require.NoError(t, err)
+	assert.Equal(t, Raw("%1\r\n+k\r\n#t\r\n"), enc)
+
+	assert.Equal(t, Fragments{Raw("+O"), Raw("K\r"), Raw("\n")}, Split(Raw("+OK\r\n"), 2))
+	assert.Equal(t, Fragments{Raw("+"), Raw("O")}, Split(Raw("+O"), 0))
+}
+
+func TestRawFragments(t *testing.T) {
+	conn := &batchConn{
+		in: bytes.NewBufferString("*1\r\n$3\r\nGET\r\n"),
+	}
+	s := &Server{}
+	s.Expect("GET").WillReturn(Split(Raw("$5\r\nhello\r\n"), 3)).Once()
+
+	require.Equal(t, io.EOF, s.serveConn(conn))
+	require.Equal(t, 4, conn.out.calls)
+	require.Equal(t, "$5\r\nhello\r\n", conn.out.String())
+}
+
+func TestRedigoMalformed(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.Expect("GET").WithArgs("wrong").WillReturn(WrongLengthBulkString("hello", 2)).Once()
+	s.Expect("GET").WithArgs("type").WillReturn(UnknownType('!', "what")).Once()
+	s.Expect("GET").WithArgs("truncated").WillReturn(TruncatedBulkString("hello", 2)).CloseConnection().Once()
+	s.Expect("GET").WithArgs("split").WillReturn(Split(Raw("$5\r\nhello\r\n"), 1)).Once()
+
+	for _, key := range []string{"wrong", "type", "truncated"} {
+		red, err := redis.Dial("tcp", s.Addr().String(), redis.DialReadTimeout(time.Second))
+		require.NoError(t, err)
+
+		_, err = redis.String(red.Do("GET", key))
+		require.Error(t, err, key)
+		_ = red.Close()
+	}
+
+	red, err := redis.Dial("tcp", s.Addr().String(), redis.DialReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer red.Close()
+
+	st, err := redis.String(red.Do("GET", "split"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", st)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestRawMissingCRLF(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.Expect("PING").WillReturn(MissingCRLF("PONG")).CloseConnection().Once()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("PING\r\n"))
+	require.NoError(t, err)
+
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "+PONG", string(res))
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
@@ -0,0 +1,138 @@
+package redimock
+
+import (
+	"sync"
+)
+
+// Sequence is a group of commands that must be called in order. a command in
+// the sequence can be called only when all the commands before it are called
+// at least the expected times. commands with Any() can be skipped.
+type Sequence struct {
+	commands      []*Command
+	perConnection bool
+
+	lock   sync.Mutex
+	states map[uint64]*sequenceState
+}
+
+type sequenceState struct {
+	pos   int
+	calls []int
+}
+
+// InOrder creates a sequence from the commands, each command can be only in
+// one sequence
+func (s *Server) InOrder(cmds ...*Command) *Sequence {
+	seq := &Sequence{
+		commands: cmds,
+	}
+	for i := range cmds {
+		cmds[i].lock.Lock()
+		cmds[i].seq = seq
+		cmds[i].seqIndex = i
+		cmds[i].lock.Unlock()
+	}
+	return seq
+}
+
+// PerConnection means the order is checked for each connection separately,
+// each connection must call the commands in order. since the expected count
+// is for all the connections, one call in each connection is enough to move
+// to the next command
+func (sq *Sequence) PerConnection() *Sequence {
+	sq.lock.Lock()
+	defer sq.lock.Unlock()
+
+	sq.perConnection = true
+	return sq
+}
+
+// MatchExpectationsInOrder makes all the expectations of the server (including
+// the ones added later) a single sequence in the order they are registered
+func (s *Server) MatchExpectationsInOrder(b bool) {
+	s.setOrder(b, false)
+}
+
+// MatchExpectationsInOrderPerConnection is like MatchExpectationsInOrder but
+// the order is checked for each connection separately
+func (s *Server) MatchExpectationsInOrderPerConnection(b bool) {
+	s.setOrder(b, true)
+}
+
+func (s *Server) setOrder(b bool, perConnection bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !b {
+		s.order = nil
+		return
+	}
+	s.order = &Sequence{perConnection: perConnection}
+}
+
+// sequenceOf returns the sequence of the command, the commands in the sequence
+// and the index of the command inside it. the server wide sequence has the
+// commands of the expect list that are not in an explicit sequence
+func (s *Server) sequenceOf(cmd *Command, expect []*Command) (*Sequence, []*Command, int) {
+	seq, idx := cmd.sequence()
+	if seq != nil {
+		return seq, seq.commands, idx
+	}
+	s.lock.RLock()
+	order := s.order
+	s.lock.RUnlock()
+	if order == nil {
+		return nil, nil, 0
+	}
+
+	var list []*Command
+	for i := range expect {
+		if expect[i] == cmd {
+			idx = len(list)
+		}
+		if seq, _ := expect[i].sequence(); seq == nil {
+			list = append(list, expect[i])
+		}
+	}
+	return order, list, idx
+}
+
+func (sq *Sequence) state(connID uint64) *sequenceState {
+	if !sq.perConnection {
+		connID = 0
+	}
+	if sq.states == nil {
+		sq.states = make(map[uint64]*sequenceState)
+	}
+	st, ok := sq.states[connID]
+	if !ok {
+		st = &sequenceState{}
+		sq.states[connID] = st
+	}
+	return st
+}
+
+// call checks if the command in index i can be called now, and if it can be,
+// moves the sequence forward. the list is the commands in the sequence
+func (sq *Sequence) call(list []*Command, i int, connID uint64) bool {
+	sq.lock.Lock()
+	defer sq.lock.Unlock()
+
+	st := sq.state(connID)
+	if i < st.pos {
+		return false
+	}
+	for len(st.calls) < len(list) {
+		st.calls = append(st.calls, 0)
+	}
+
+	for j := st.pos; j < i; j++ {
+		if !list[j].satisfied(st.calls[j], sq.perConnection) {
+			return false
+		}
+	}
+
+	st.pos = i
+	st.calls[i]++
+	return true
+}
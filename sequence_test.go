@@ -0,0 +1,234 @@
+package redimock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceInOrder(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.InOrder(
+		s.Expect("WATCH").WithArgs("key").WillReturn("OK").Once(),
+		s.ExpectGet("key", true, "1").Once(),
+		s.Expect("MULTI").WillReturn("OK").Once(),
+		s.ExpectSet("key", "2", true).WillReturn("QUEUED").Once(),
+		s.Expect("EXEC").WillReturn([]interface{}{"OK"}).Once(),
+	)
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("WATCH", "key")
+	require.NoError(t, err)
+	v, err := redis.String(red.Do("GET", "key"))
+	require.NoError(t, err)
+	require.Equal(t, "1", v)
+	_, err = red.Do("MULTI")
+	require.NoError(t, err)
+	_, err = red.Do("SET", "key", "2")
+	require.NoError(t, err)
+	_, err = red.Do("EXEC")
+	require.NoError(t, err)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestSequenceOutOfOrder(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.InOrder(
+		s.Expect("MULTI").WillReturn("OK").Once(),
+		s.Expect("EXEC").WillReturn([]interface{}{}).Once(),
+	)
+	// Not in the sequence, can be called any time
+	s.ExpectPing().Any()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("EXEC")
+	require.EqualError(t, err, "command called out of order")
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	_, err = red.Do("MULTI")
+	require.NoError(t, err)
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	_, err = red.Do("EXEC")
+	require.NoError(t, err)
+	// Can not go back
+	_, err = red.Do("MULTI")
+	require.Error(t, err)
+
+	err = s.ExpectationsWereMet()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "command EXEC is called out of order")
+	require.Contains(t, err.Error(), "command MULTI is called out of order")
+}
+
+func TestSequenceSkipAny(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.InOrder(
+		s.Expect("A").WillReturn("OK").Times(2),
+		s.Expect("B").WillReturn("OK").Any(),
+		s.Expect("C").WillReturn("OK").Once(),
+	)
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("A")
+	require.NoError(t, err)
+	_, err = red.Do("C")
+	require.Error(t, err)
+	_, err = red.Do("A")
+	require.NoError(t, err)
+	_, err = red.Do("C")
+	require.NoError(t, err)
+
+	err = s.ExpectationsWereMet()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "command C is called out of order")
+}
+
+func TestServerMatchInOrder(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.MatchExpectationsInOrder(true)
+	s.ExpectSet("a", "1", true).Once()
+	s.ExpectSet("b", "2", true).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("SET", "b", "2")
+	require.Error(t, err)
+	_, err = red.Do("SET", "a", "1")
+	require.NoError(t, err)
+	_, err = red.Do("SET", "b", "2")
+	require.NoError(t, err)
+
+	err = s.ExpectationsWereMet()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "command SET b 2 is called out of order")
+
+	s.MatchExpectationsInOrder(false)
+	s.ExpectSet("c", "3", true).Once()
+	s.ExpectSet("d", "4", true).Once()
+	_, err = red.Do("SET", "d", "4")
+	require.NoError(t, err)
+}
+
+func TestSequencePerConnection(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.InOrder(
+		s.Expect("MULTI").WillReturn("OK").Times(2),
+		s.Expect("EXEC").WillReturn([]interface{}{}).Times(2),
+	).PerConnection()
+
+	red1, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red1.Close()
+
+	red2, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red2.Close()
+
+	_, err = red1.Do("MULTI")
+	require.NoError(t, err)
+	_, err = red2.Do("EXEC")
+	require.Error(t, err)
+	_, err = red2.Do("MULTI")
+	require.NoError(t, err)
+	_, err = red1.Do("EXEC")
+	require.NoError(t, err)
+	_, err = red2.Do("EXEC")
+	require.NoError(t, err)
+
+	err = s.ExpectationsWereMet()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "command EXEC is called out of order")
+
+	s, err = NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.MatchExpectationsInOrderPerConnection(true)
+	s.Expect("MULTI").WillReturn("OK").Times(2)
+	s.Expect("EXEC").WillReturn([]interface{}{}).Times(2)
+
+	red1, err = redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red1.Close()
+
+	red2, err = redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red2.Close()
+
+	for _, red := range []redis.Conn{red1, red2} {
+		_, err = red.Do("MULTI")
+		require.NoError(t, err)
+	}
+	for _, red := range []redis.Conn{red1, red2} {
+		_, err = red.Do("EXEC")
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestSequenceWithServerOrder(t *testing.T) {
+	s := NewTestServer(t)
+
+	s.MatchExpectationsInOrder(true)
+	s.InOrder(
+		s.Expect("MULTI").WillReturn("OK").Once(),
+		s.Expect("EXEC").WillReturn([]interface{}{}).Once(),
+	)
+	s.ExpectPing().Once()
+	s.ExpectGet("key", true, "v").Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("MULTI")
+	require.NoError(t, err)
+	_, err = red.Do("EXEC")
+	require.NoError(t, err)
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	_, err = red.Do("GET", "key")
+	require.NoError(t, err)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
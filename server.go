@@ -4,9 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,117 +19,440 @@ import (
 type Command struct {
 	command    string
 	argCompare func(...string) bool
+	argDesc    string
 	responses  []interface{}
+	ready      bool
 	count      int
 	terminate  bool
 	delay      time.Duration
-
-	lock   sync.RWMutex
-	called int
+	slow       slowWrite
+	seq        *Sequence
+	seqIndex   int
+
+	lock    sync.RWMutex
+	called  int
+	calls   []Call
+	changed chan struct{}
 }
 
 // Result is the function that can be used for advanced result value
 type Result = func(...string) []interface{}
 
+// Option is used to configure the server in NewServer
+type Option func(*Server)
+
+// WithChunks is the server wide default for writing the responses in chunks,
+// see Command.WithChunks
+func WithChunks(size int, pause time.Duration) Option {
+	return func(s *Server) {
+		s.slow.size = size
+		s.slow.pause = pause
+	}
+}
+
+// WithFailFast closes the connection right after replying to an unexpected or
+// out of order command, so the code under test fails immediately. with
+// NewTestServer the test is also marked as failed at the same time
+func WithFailFast() Option {
+	return func(s *Server) {
+		s.failFast = true
+	}
+}
+
+// WithStall is the server wide default for stalling in the middle of the
+// responses, see Command.WithStall
+func WithStall(after int, d time.Duration) Option {
+	return func(s *Server) {
+		s.slow.stallAt = after
+		s.slow.stall = d
+	}
+}
+
+// WithNetwork sets the network of the listener, tcp (the default), tcp4, tcp6,
+// unix or memory. for unix with an empty address, a socket in a temporary
+// directory is used and it is removed when the server is closed. memory is an
+// in-memory listener without any port, connect to it with Server.DialContext
+func WithNetwork(network string) Option {
+	return func(s *Server) {
+		s.network = network
+	}
+}
+
 // Server is the mock server used for handling the connections
 type Server struct {
 	listener net.Listener
+	memory   *memoryListener
+	network  string
+	tls      *tlsState
+	tempDir  string
+	slow     slowWrite
+	failFast bool
+	reporter func(string)
+	hooks    hooks
+	logger   *slog.Logger
+
+	maxClients int
+	rejectMode RejectMode
+
+	wg       sync.WaitGroup
+	stopped  chan struct{}
+	watching chan struct{}
+	closing  bool
+	closed   bool
+	conns    map[*client]bool
 
 	expectList         []*Command
 	lock               sync.RWMutex
+	matchLock          sync.Mutex
 	unexpectedCommands [][]string
+	outOfOrderCommands [][]string
+	calls              []Call
+	changed            chan struct{}
+	done               chan struct{}
+	order              *Sequence
+	lastID             uint64
 }
 
-// NewServer makes a server listening on addr. Close with .Close().
-func NewServer(ctx context.Context, addr string) (*Server, error) {
+// NewServer makes a server listening on addr. Close with .Close() or
+// .Shutdown(), canceling the ctx closes the server without waiting
+func NewServer(ctx context.Context, addr string, opts ...Option) (*Server, error) {
 	s := Server{}
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
+	for i := range opts {
+		opts[i](&s)
+	}
+	if s.network == "" {
+		s.network = "tcp"
+	}
+	if s.network == "unix" && addr == "" {
+		dir, err := os.MkdirTemp("", "redimock")
+		if err != nil {
+			return nil, err
+		}
+		s.tempDir = dir
+		addr = filepath.Join(dir, "redis.sock")
+	}
+	if s.tls != nil {
+		if err := s.tls.setup(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.listen(s.network, addr); err != nil {
+		s.removeTemp()
 		return nil, err
 	}
-	s.listener = l
-	go s.serve()
+	s.watch(ctx)
+	return &s, nil
+}
+
+// NewServerFromListener makes a server serving on the listener, the listener
+// is closed with the server. Start (after Stop) listens on the same address
+// with net.Listen
+func NewServerFromListener(ctx context.Context, l net.Listener, opts ...Option) (*Server, error) {
+	s := Server{}
+	for i := range opts {
+		opts[i](&s)
+	}
+	s.network = l.Addr().Network()
+	if s.tls != nil {
+		if err := s.tls.setup(); err != nil {
+			return nil, err
+		}
+	}
+	s.serveListener(l)
+	s.watch(ctx)
+	return &s, nil
+}
+
+// watch closes the server when the ctx is done
+func (s *Server) watch(ctx context.Context) {
+	s.stopped = make(chan struct{})
+	s.watching = make(chan struct{})
 	go func() {
-		<-ctx.Done()
-		_ = l.Close()
+		defer close(s.watching)
+		select {
+		case <-ctx.Done():
+			s.finish()
+			s.stop(true)
+		case <-s.stopped:
+		}
 	}()
-	return &s, nil
 }
 
-func (s *Server) serve() {
+func (s *Server) serve(l net.Listener) {
+	defer s.wg.Done()
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := l.Accept()
 		if err != nil {
 			return
 		}
+		s.wg.Add(1)
 		go func() {
-			// TODO : add this err to log?
+			defer s.wg.Done()
+			// the error is passed to the OnDisconnect hook
 			_ = s.serveConn(conn)
 		}()
 	}
 }
 
-// ServeConn handles a connection
-func (s *Server) serveConn(conn io.ReadWriteCloser) error {
-	defer func() {
+// ServeConn serves a connection accepted outside of the server, it returns
+// when the connection is closed by either side, the ctx is done or the server
+// is closed. the connection is closed when it returns
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	s.lock.Lock()
+	if s.closing {
+		s.lock.Unlock()
 		_ = conn.Close()
+		return ErrServerClosed
+	}
+	s.wg.Add(1)
+	s.lock.Unlock()
+	defer s.wg.Done()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
 	}()
+
+	err := s.serveConn(conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// serveConn handles a connection
+func (s *Server) serveConn(conn io.ReadWriteCloser) (err error) {
+	cl := newClient(conn)
+	cl.id = atomic.AddUint64(&s.lastID, 1)
+	defer func() {
+		s.untrack(cl)
+		_ = cl.close()
+	}()
+	if err := s.track(cl); err != nil {
+		if err == errMaxClients {
+			return s.reject(cl)
+		}
+		return err
+	}
+	s.logConnect(cl)
+	s.hooks.connect(cl)
+	defer func() {
+		s.logDisconnect(cl, err)
+		s.hooks.disconnect(cl, err)
+	}()
+	if err := cl.handshake(); err != nil {
+		return err
+	}
 	for {
-		args, err := readArray(conn)
+		args, err := cl.readCommand()
 		if err != nil {
+			if isClosed(cl.kill) {
+				return s.killError()
+			}
 			// Close the connection and return, error in client should not break the server
 			return err
 		}
-
-		var cmd *Command
-		for i := range s.expectList {
-			if s.expectList[i].compare(args) {
-				cmd = s.expectList[i]
-				cmd.increase()
-				break
-			}
+		if len(args) == 0 {
+			// empty inline command or empty array, redis ignores them
+			continue
+		}
+		if !s.setBusy(cl, true) {
+			// the server is shutting down, do not start a new command
+			return ErrServerClosed
+		}
+		cl.received()
+		call := Call{
+			ConnID:        cl.id,
+			ClientName:    cl.name,
+			TLSServerName: cl.tlsServerName,
+			TLSSubject:    cl.tlsSubject,
+			Command:       strings.ToUpper(args[0]),
+			Args:          args[1:],
+			ReceivedAt:    time.Now(),
 		}
+		s.log(slog.LevelDebug, "request", "conn", call.ConnID, "command", call.String())
+		s.hooks.command(call)
 
+		cmd, outOfOrder := s.match(cl, args)
 		if cmd == nil {
-			// Return error *and continue?*
-			if err := write(conn, Error("command not expected")); err != nil {
-				return err // this means the write was not successful , close the connection
+			e := Error("command not expected")
+			if outOfOrder {
+				e = Error("command called out of order")
 			}
+			// the test must have the failure before the client has the error
 			s.lock.Lock()
-			s.unexpectedCommands = append(s.unexpectedCommands, args)
+			if outOfOrder {
+				s.outOfOrderCommands = append(s.outOfOrderCommands, args)
+			} else {
+				s.unexpectedCommands = append(s.unexpectedCommands, args)
+			}
+			uErr := s.unexpectedError(args, outOfOrder)
 			s.lock.Unlock()
+			s.log(slog.LevelWarn, "unexpected command", "conn", call.ConnID, "command", call.String(), "error", uErr)
+			s.reportf("%s", uErr)
+
+			// Return error *and continue?*
+			sw := s.slow
+			sw.abort = cl.kill
+			entry := s.record(call, nil, []interface{}{e})
+			err := s.replyTo(cl, entry, sw, e)
+			if err != nil {
+				return err // this means the write was not successful , close the connection
+			}
+			if s.failFast {
+				return uErr
+			}
+			if !s.setBusy(cl, false) {
+				return ErrServerClosed
+			}
 			continue
 		}
 
-		if cmd.delay > 0 {
-			time.Sleep(cmd.delay)
+		rsp, delay, sw, terminate := cmd.behavior()
+		if delay > 0 {
+			// the previous responses in the pipeline should not wait for this one
+			if err := cl.flush(); err != nil {
+				return err
+			}
+			if !sleep(cl.kill, delay) {
+				// the call is in the journal with the error, RepliedAt is zero
+				// since there is no reply and the wait helpers do not count it
+				kErr := s.killError()
+				entry := s.record(call, cmd, nil)
+				s.replied(entry, kErr)
+				return kErr
+			}
 		}
 
-		rsp := cmd.responses
 		if len(rsp) == 1 {
 			fn, ok := rsp[0].(Result)
 			if ok {
 				rsp = fn(args[1:]...)
 			}
 		}
-		if err := write(conn, rsp...); err != nil {
+		cl.track(args, rsp)
+		if !sw.enabled() {
+			sw = s.slow
+		}
+		sw.abort = cl.kill
+		entry := s.record(call, cmd, rsp)
+		err = s.replyTo(cl, entry, sw, rsp...)
+		if err != nil {
+			if isClosed(cl.kill) {
+				// the connection is closed by the server
+				return s.killError()
+			}
+			s.reportf("writing the reply of %s failed: %s", call, err)
 			// write failed, return and close the connection
 			return err
 		}
 
-		if cmd.terminate {
+		if terminate {
 			return nil
 		}
+		if !s.setBusy(cl, false) {
+			return ErrServerClosed
+		}
+	}
+}
+
+// match finds the first expectation for the command. the expectations that are
+// called the expected times are skipped, so the next one can match. if there is
+// no other match, the first exhausted one is used and it fails later in
+// ExpectationsWereMet. the commands inside a sequence are matched only when they
+// are called in order, the second return value is true when there was a match
+// but not in order
+func (s *Server) match(cl *client, args []string) (*Command, bool) {
+	// matching and moving the sequences forward must be atomic, or two
+	// connections can both use the last call of an expectation
+	s.matchLock.Lock()
+	defer s.matchLock.Unlock()
+
+	var (
+		list       = s.expectations()
+		outOfOrder bool
+		exhausted  = -1
+	)
+	for i := range list {
+		cmd := list[i]
+		if !cmd.compare(args) || !cmd.isReady() {
+			continue
+		}
+		if cmd.exhausted() {
+			if exhausted < 0 {
+				exhausted = i
+			}
+			continue
+		}
+		if !s.inOrder(cl, list, cmd) {
+			outOfOrder = true
+			continue
+		}
+		cmd.increase()
+		return cmd, false
+	}
+	if exhausted >= 0 && !outOfOrder {
+		cmd := list[exhausted]
+		if !s.inOrder(cl, list, cmd) {
+			return nil, true
+		}
+		cmd.increase()
+		return cmd, false
 	}
+	return nil, outOfOrder
+}
+
+// inOrder checks the sequence of the command and moves it forward if the
+// command is in order
+func (s *Server) inOrder(cl *client, expect []*Command, cmd *Command) bool {
+	seq, list, idx := s.sequenceOf(cmd, expect)
+	if seq == nil {
+		return true
+	}
+	return seq.call(list, idx, cl.id)
+}
+
+// expectations returns a copy of the expect list, so it can be used without
+// the lock
+func (s *Server) expectations() []*Command {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]*Command(nil), s.expectList...)
 }
 
-// Addr has the net.Addr struct
+// Addr has the net.Addr struct, it is nil if the server is not listening on
+// tcp, use NetAddr for the other networks
 func (s *Server) Addr() *net.TCPAddr {
-	return s.listener.Addr().(*net.TCPAddr)
+	addr, _ := s.NetAddr().(*net.TCPAddr)
+	return addr
+}
+
+// NetAddr is the address of the listener, the Network() and String() of the
+// address can be used to dial the server, like redis.Dial(a.Network(), a.String())
+func (s *Server) NetAddr() net.Addr {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
 }
 
 // ExpectationsWereMet return nil if the all expects match or error if not
 func (s *Server) ExpectationsWereMet() error {
+	return s.verify(true)
+}
+
+// verify returns the error for the expectations, the unexpected and out of
+// order commands are included only if the unexpected is true
+func (s *Server) verify(unexpected bool) error {
 	s.lock.RLock()
 	var all []error
 	for i := range s.expectList {
@@ -133,11 +461,14 @@ func (s *Server) ExpectationsWereMet() error {
 		}
 	}
 
-	for i := range s.unexpectedCommands {
-		all = append(all, fmt.Errorf(
-			"command %s is called but not expected",
-			strings.Join(s.unexpectedCommands[i], " ")),
-		)
+	if unexpected {
+		for i := range s.unexpectedCommands {
+			all = append(all, s.unexpectedError(s.unexpectedCommands[i], false))
+		}
+
+		for i := range s.outOfOrderCommands {
+			all = append(all, s.unexpectedError(s.outOfOrderCommands[i], true))
+		}
 	}
 	s.lock.RUnlock()
 
@@ -152,44 +483,103 @@ func (s *Server) ExpectationsWereMet() error {
 	return nil
 }
 
-// Expect return a command
+// unexpectedError returns the error for the unexpected or out of order command,
+// the lock must be held by the caller
+func (s *Server) unexpectedError(args []string, outOfOrder bool) error {
+	if outOfOrder {
+		return fmt.Errorf("command %s is called out of order", strings.Join(args, " "))
+	}
+	return fmt.Errorf(
+		"command %s is called but not expected%s",
+		strings.Join(args, " "),
+		s.describeExpected(args[0]),
+	)
+}
+
+// describeExpected returns the expectations with the same command name, to
+// make the error message more useful
+func (s *Server) describeExpected(command string) string {
+	command = strings.ToUpper(command)
+	var desc []string
+	for i := range s.expectList {
+		if s.expectList[i].command == command {
+			desc = append(desc, s.expectList[i].String())
+		}
+	}
+	if len(desc) == 0 {
+		return ""
+	}
+	return ", expected one of: " + strings.Join(desc, "; ")
+}
+
+// Expect return a command. it can be called while serving, the command is
+// matched only after it has the reply with WillReturn
 func (s *Server) Expect(command string) *Command {
 	c := &Command{
 		command: strings.ToUpper(command),
 	}
 
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	s.expectList = append(s.expectList, c)
 	return c
 }
 
 // WithArgs add array as arguments
 func (c *Command) WithArgs(args ...string) *Command {
-	return c.WithFnArgs(func(s ...string) bool {
+	quoted := make([]string, len(args))
+	for i := range args {
+		quoted[i] = strconv.Quote(args[i])
+	}
+	return c.setArgs(func(s ...string) bool {
 		if len(s) != len(args) {
 			return false
 		}
 
 		return equalArgs(s, args)
-	})
+	}, strings.Join(quoted, " "))
+}
+
+// WithArgMatchers add a matcher for each argument, the last one can be Rest to
+// match all the remaining arguments
+func (c *Command) WithArgMatchers(matchers ...ArgMatcher) *Command {
+	return c.setArgs(func(s ...string) bool {
+		return matchArgs(s, matchers)
+	}, describeMatchers(matchers))
 }
 
 // WithAnyArgs if any argument is ok
 func (c *Command) WithAnyArgs() *Command {
-	return c.WithFnArgs(func(...string) bool {
-		return true
-	})
+	return c.WithArgMatchers(Rest(AnyArg()))
 }
 
 // WithFnArgs is advanced function compare for arguments
 func (c *Command) WithFnArgs(f func(...string) bool) *Command {
+	return c.setArgs(f, "<custom>")
+}
+
+func (c *Command) setArgs(f func(...string) bool, desc string) *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	// TODO : may be panic() if the function already set
 	c.argCompare = f
+	c.argDesc = desc
 	return c
 }
 
-// WillReturn set the return value for this command
+// WillReturn set the return value for this command. Go values are converted to
+// the redis types, string is simple string, []byte is bulk string, all integers
+// are integer, floats are double, bool is boolean, error is a redis error, nil
+// is null, slices are arrays and maps are maps (array in RESP2) with sorted keys.
+// time.Duration is an integer in seconds
 func (c *Command) WillReturn(ret ...interface{}) *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.responses = ret
+	c.ready = true
 
 	return c
 }
@@ -201,30 +591,62 @@ func (c *Command) WillReturnFn(r Result) *Command {
 
 // WithDelay return command with delay
 func (c *Command) WithDelay(d time.Duration) *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.delay = d
 	return c
 }
 
-// Once means it should be called once
+// Once means it should be called once, after that the next matching expectation
+// is used if there is any
 func (c *Command) Once() *Command {
-	c.count = 1
-	return c
+	return c.Times(1)
 }
 
 // Any means this can be called 0 to n time
 func (c *Command) Any() *Command {
-	c.count = -1
-	return c
+	return c.Times(-1)
 }
 
-// Times this should be called n times
+// Times this should be called n times, after that the next matching expectation
+// is used if there is any
 func (c *Command) Times(n int) *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.count = n
 	return c
 }
 
+// WithChunks writes the response in chunks of size bytes with a pause between
+// them, to simulate a slow network
+func (c *Command) WithChunks(size int, pause time.Duration) *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.slow.size = size
+	c.slow.pause = pause
+	return c
+}
+
+// WithStall writes the first after bytes of the response and then stalls for
+// the duration before writing the rest of it, with after zero (or negative) it
+// stalls before the first byte. it can be combined with WithChunks
+func (c *Command) WithStall(after int, d time.Duration) *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.slow.stallAt = after
+	c.slow.stall = d
+	return c
+}
+
 // CloseConnection should close connection after this command
 func (c *Command) CloseConnection() *Command {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.terminate = true
 	return c
 }
@@ -238,8 +660,11 @@ func (c *Command) compare(input []string) bool {
 		return false
 	}
 
-	if c.argCompare != nil {
-		return c.argCompare(input[1:]...)
+	c.lock.RLock()
+	argCompare := c.argCompare
+	c.lock.RUnlock()
+	if argCompare != nil {
+		return argCompare(input[1:]...)
 	}
 
 	return len(input) == 1
@@ -253,14 +678,88 @@ func (c *Command) error() error {
 		return nil
 	}
 
+	var args string
+	if c.argDesc != "" {
+		args = " with args " + c.argDesc
+	}
 	return fmt.Errorf(
-		`command "%s" expected %d time called %d times`,
+		`command "%s"%s expected %d time called %d times`,
 		c.command,
+		args,
 		c.count,
 		c.called,
 	)
 }
 
+// String returns the description of the command and its arguments
+func (c *Command) String() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.argDesc == "" {
+		return c.command
+	}
+	return c.command + " " + c.argDesc
+}
+
+// exhausted returns true if the command is already called the expected times,
+// commands without count are never exhausted
+func (c *Command) exhausted() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.count > 0 && c.called >= c.count
+}
+
+// satisfied returns true if calls is enough for this command, if the calls are
+// only for one connection then one call is enough
+func (c *Command) satisfied(calls int, perConnection bool) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if perConnection && calls > 0 {
+		return true
+	}
+	return c.count < 0 || calls >= c.count
+}
+
+// behavior returns the settings used for replying to the command
+func (c *Command) behavior() (responses []interface{}, delay time.Duration, sw slowWrite, terminate bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.responses, c.delay, c.slow, c.terminate
+}
+
+// isReady is true when the command has the reply, an expectation added while
+// serving is not matched in the middle of its builder chain
+func (c *Command) isReady() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.ready
+}
+
+// sequence returns the explicit sequence of the command and the index in it
+func (c *Command) sequence() (*Sequence, int) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.seq, c.seqIndex
+}
+
+// repliedTimes is the number of the calls in the journal with the reply, the
+// lock must be held by the caller
+func (c *Command) repliedTimes() int {
+	var n int
+	for i := range c.calls {
+		if !c.calls[i].RepliedAt.IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
 func (c *Command) increase() {
 	c.lock.Lock()
 	c.called++
@@ -0,0 +1,266 @@
+package redimock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedigoPipeline(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectSet("key1", "value1", true).Once()
+	s.ExpectSet("key2", "value2", true).Once()
+	s.ExpectGet("key1", true, "value1").Once()
+	s.ExpectGet("key3", false, "").Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	require.NoError(t, red.Send("SET", "key1", "value1"))
+	require.NoError(t, red.Send("SET", "key2", "value2"))
+	require.NoError(t, red.Send("GET", "key1"))
+	require.NoError(t, red.Send("GET", "key3"))
+	require.NoError(t, red.Flush())
+
+	for i := 0; i < 2; i++ {
+		st, err := redis.String(red.Receive())
+		require.NoError(t, err)
+		require.Equal(t, "OK", st)
+	}
+
+	st, err := redis.String(red.Receive())
+	require.NoError(t, err)
+	require.Equal(t, "value1", st)
+
+	_, err = redis.String(red.Receive())
+	require.Equal(t, redis.ErrNil, err)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestRedigoTransaction(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.Expect("MULTI").WillReturn("OK").Once()
+	s.Expect("SET").WithArgs("key1", "value1").WillReturn("QUEUED").Once()
+	s.Expect("GET").WithArgs("key1").WillReturn("QUEUED").Once()
+	s.Expect("EXEC").WillReturn([]interface{}{"OK", BulkString("value1")}).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	require.NoError(t, red.Send("MULTI"))
+	require.NoError(t, red.Send("SET", "key1", "value1"))
+	require.NoError(t, red.Send("GET", "key1"))
+	ret, err := redis.Values(red.Do("EXEC"))
+	require.NoError(t, err)
+	require.Len(t, ret, 2)
+
+	st, err := redis.String(ret[0], nil)
+	require.NoError(t, err)
+	require.Equal(t, "OK", st)
+
+	st, err = redis.String(ret[1], nil)
+	require.NoError(t, err)
+	require.Equal(t, "value1", st)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestRedigoBigPipeline(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	const count = 1000
+	// Bigger than the default buffer size of the reader
+	value := strings.Repeat("X", 8192)
+	s.Expect("SET").WithAnyArgs().WillReturn("OK").Times(count)
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	for i := 0; i < count; i++ {
+		require.NoError(t, red.Send("SET", fmt.Sprintf("key%d", i), value))
+	}
+	require.NoError(t, red.Flush())
+
+	for i := 0; i < count; i++ {
+		st, err := redis.String(red.Receive())
+		require.NoError(t, err)
+		require.Equal(t, "OK", st)
+	}
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestRedigoBigPipelineMemory(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+
+	// the replies are written while the client is still writing the pipeline
+	const count = 5000
+	s.Expect("SET").WithAnyArgs().WillReturn("OK").Times(count)
+
+	red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+	require.NoError(t, err)
+	defer red.Close()
+
+	for i := 0; i < count; i++ {
+		require.NoError(t, red.Send("SET", fmt.Sprintf("key%d", i), "value"))
+	}
+	require.NoError(t, red.Flush())
+
+	for i := 0; i < count; i++ {
+		st, err := redis.String(red.Receive())
+		require.NoError(t, err)
+		require.Equal(t, "OK", st)
+	}
+}
+
+func TestGoRedisPipeline(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectSet("key1", "value1", true).Once()
+	s.ExpectGet("key1", true, "value1").Once()
+	s.ExpectHSet("hash", "fld", "value", false).Once()
+	s.ExpectGet("key2", false, "").Once()
+
+	cl := goredis.NewClient(&goredis.Options{
+		Addr: s.Addr().String(),
+	})
+	defer cl.Close()
+
+	pipe := cl.Pipeline()
+	set := pipe.Set("key1", "value1", 0)
+	get := pipe.Get("key1")
+	hset := pipe.HSet("hash", "fld", "value")
+	missing := pipe.Get("key2")
+	_, err = pipe.Exec()
+	require.Equal(t, goredis.Nil, err)
+
+	require.NoError(t, set.Err())
+	require.Equal(t, "OK", set.Val())
+	require.NoError(t, get.Err())
+	require.Equal(t, "value1", get.Val())
+	require.NoError(t, hset.Err())
+	require.True(t, hset.Val())
+	require.Equal(t, goredis.Nil, missing.Err())
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestGoRedisTxPipeline(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.Expect("MULTI").WillReturn("OK").Once()
+	s.Expect("SET").WithArgs("key1", "value1").WillReturn("QUEUED").Once()
+	s.Expect("INCR").WithArgs("counter").WillReturn("QUEUED").Once()
+	s.Expect("EXEC").WillReturn([]interface{}{"OK", 10}).Once()
+
+	cl := goredis.NewClient(&goredis.Options{
+		Addr: s.Addr().String(),
+	})
+	defer cl.Close()
+
+	var (
+		set  *goredis.StatusCmd
+		incr *goredis.IntCmd
+	)
+	_, err = cl.TxPipelined(func(pipe goredis.Pipeliner) error {
+		set = pipe.Set("key1", "value1", 0)
+		incr = pipe.Incr("counter")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "OK", set.Val())
+	require.Equal(t, int64(10), incr.Val())
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestGoRedisBigPipeline(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	const count = 500
+	s.Expect("INCR").WithAnyArgs().WillReturn(1).Times(count)
+
+	cl := goredis.NewClient(&goredis.Options{
+		Addr: s.Addr().String(),
+	})
+	defer cl.Close()
+
+	pipe := cl.Pipeline()
+	for i := 0; i < count; i++ {
+		pipe.Incr(fmt.Sprintf("counter%d", i))
+	}
+	cmds, err := pipe.Exec()
+	require.NoError(t, err)
+	require.Len(t, cmds, count)
+	for i := range cmds {
+		require.Equal(t, int64(1), cmds[i].(*goredis.IntCmd).Val())
+	}
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestPipelineSingleWrite(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectPing().Times(3)
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPING\r\n*2\r\n$4\r\nPING\r\n$2\r\nHI\r\n"))
+	require.NoError(t, err)
+
+	expected := "+PONG\r\n+PONG\r\n+HI\r\n"
+	buf := make([]byte, len(expected))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for pos := 0; pos < len(buf); {
+		n, err := conn.Read(buf[pos:])
+		require.NoError(t, err)
+		pos += n
+	}
+	require.Equal(t, expected, string(buf))
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
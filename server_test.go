@@ -1,12 +1,15 @@
 package redimock
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"io"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/require"
 )
 
@@ -14,7 +17,7 @@ func TestGoRedisServerExpectationNotMet(t *testing.T) {
 	ctx, cnl := context.WithCancel(context.Background())
 	defer cnl()
 
-	s, err := NewServer(ctx, ":12345")
+	s, err := NewServer(ctx, "", WithNetwork("memory"))
 	require.NoError(t, err)
 
 	s.ExpectGet("abcd", true, "test").Once()
@@ -76,3 +79,244 @@ func TestCommandCompare(t *testing.T) {
 	require.True(t, cmd.compare([]string{"ping", "xxx"}))
 
 }
+
+func TestServerHello(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectHello(4).Once()
+	s.ExpectHello(3).Once()
+	s.ExpectHello(2).Once()
+	s.ExpectGet("key", false, "").Times(2)
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	readLine := func() string {
+		line, err := rd.ReadString('\n')
+		require.NoError(t, err)
+		return line
+	}
+
+	_, err = conn.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n4\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "-NOPROTO unsupported protocol version\r\n", readLine())
+
+	_, err = conn.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "%7\r\n", readLine())
+	for i := 0; i < 24; i++ {
+		readLine()
+	}
+	require.Equal(t, "*0\r\n", readLine())
+
+	_, err = conn.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "_\r\n", readLine())
+
+	_, err = conn.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n2\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "*14\r\n", readLine())
+	for i := 0; i < 24; i++ {
+		readLine()
+	}
+	require.Equal(t, "*0\r\n", readLine())
+
+	_, err = conn.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "$-1\r\n", readLine())
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestServerInline(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectPing().Once()
+	s.ExpectSet("key", "hello world", true).Once()
+	s.ExpectQuit().Once()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("PING\r\n\r\nSET key \"hello world\"\nQUIT\r\n"))
+	require.NoError(t, err)
+
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "+PONG\r\n+OK\r\n+OK\r\n", string(res))
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+type batchConn struct {
+	in  *bytes.Buffer
+	out countWriter
+}
+
+func (b *batchConn) Read(p []byte) (int, error) {
+	return b.in.Read(p)
+}
+
+func (b *batchConn) Write(p []byte) (int, error) {
+	return b.out.Write(p)
+}
+
+func (b *batchConn) Close() error {
+	return nil
+}
+
+func TestServerServeConnBatch(t *testing.T) {
+	s := &Server{}
+	s.ExpectPing().Any()
+	s.Expect("GET").WithAnyArgs().WillReturn([]byte("100%")).Any()
+
+	conn := &batchConn{
+		in: bytes.NewBufferString("*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\nPING\r\n"),
+	}
+	require.Equal(t, io.EOF, s.serveConn(conn))
+	require.Equal(t, 1, conn.out.calls)
+	require.Equal(t, "+PONG\r\n$4\r\n100%\r\n+PONG\r\n", conn.out.String())
+}
+
+func TestServerSlowWrite(t *testing.T) {
+	s := &Server{}
+	s.Expect("GET").WithArgs("chunk").WillReturn(BulkString("0123456789")).WithChunks(5, time.Millisecond).Once()
+	s.Expect("GET").WithArgs("stall").WillReturn(BulkString("0123456789")).WithStall(8, 50*time.Millisecond).Once()
+
+	conn := &batchConn{
+		in: bytes.NewBufferString("GET chunk\r\n"),
+	}
+	require.Equal(t, io.EOF, s.serveConn(conn))
+	require.Equal(t, 4, conn.out.calls)
+	require.Equal(t, "$10\r\n0123456789\r\n", conn.out.String())
+
+	conn = &batchConn{
+		in: bytes.NewBufferString("GET stall\r\n"),
+	}
+	start := time.Now()
+	require.Equal(t, io.EOF, s.serveConn(conn))
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+	require.Equal(t, 2, conn.out.calls)
+	require.Equal(t, "$10\r\n0123456789\r\n", conn.out.String())
+
+	s.Expect("GET").WithArgs("first").WillReturn(BulkString("0123456789")).WithStall(0, 50*time.Millisecond).Once()
+	conn = &batchConn{
+		in: bytes.NewBufferString("GET first\r\n"),
+	}
+	start = time.Now()
+	require.Equal(t, io.EOF, s.serveConn(conn))
+	require.True(t, time.Since(start) >= 50*time.Millisecond, "stall before the first byte")
+	require.Equal(t, 1, conn.out.calls)
+	require.Equal(t, "$10\r\n0123456789\r\n", conn.out.String())
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestServerSlowWriteDefault(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "", WithChunks(1, 0), WithStall(3, 300*time.Millisecond))
+	require.NoError(t, err)
+
+	s.ExpectGet("key", true, "value").Times(2)
+	s.ExpectGet("fast", true, "value").WithChunks(100, 0).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String(), redis.DialReadTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	_, err = red.Do("GET", "key")
+	require.Error(t, err)
+	_ = red.Close()
+
+	red, err = redis.Dial("tcp", s.Addr().String(), redis.DialReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer red.Close()
+
+	st, err := redis.String(red.Do("GET", "key"))
+	require.NoError(t, err)
+	require.Equal(t, "value", st)
+
+	st, err = redis.String(red.Do("GET", "fast"))
+	require.NoError(t, err)
+	require.Equal(t, "value", st)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestServerExhaustedFallThrough(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectGet("k", true, "v1").Once()
+	s.ExpectGet("k", true, "v2").Times(2)
+	s.ExpectGet("k", false, "").Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	for _, v := range []string{"v1", "v2", "v2"} {
+		st, err := redis.String(red.Do("GET", "k"))
+		require.NoError(t, err)
+		require.Equal(t, v, st)
+	}
+	_, err = redis.String(red.Do("GET", "k"))
+	require.Equal(t, redis.ErrNil, err)
+	require.NoError(t, s.ExpectationsWereMet())
+
+	// All are exhausted, the first one is used
+	st, err := redis.String(red.Do("GET", "k"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", st)
+	require.EqualError(t, s.ExpectationsWereMet(), "command \"GET\" with args \"k\" expected 1 time called 2 times\n")
+}
+
+func TestSequenceExhausted(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.InOrder(
+		s.ExpectGet("k", true, "v1").Once(),
+		s.ExpectSet("k", "v2", true).Once(),
+		s.ExpectGet("k", true, "v2").Once(),
+	)
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	st, err := redis.String(red.Do("GET", "k"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", st)
+
+	_, err = red.Do("GET", "k")
+	require.EqualError(t, err, "command called out of order")
+
+	_, err = red.Do("SET", "k", "v2")
+	require.NoError(t, err)
+
+	st, err = redis.String(red.Do("GET", "k"))
+	require.NoError(t, err)
+	require.Equal(t, "v2", st)
+
+	err = s.ExpectationsWereMet()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "command GET k is called out of order")
+}
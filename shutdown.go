@@ -0,0 +1,248 @@
+package redimock
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+var (
+	// ErrServerClosed is returned when the server is closed
+	ErrServerClosed = errors.New("redimock: server closed")
+	// ErrTLSDisabled is returned when a TLS function is called on a server without TLS
+	ErrTLSDisabled = errors.New("redimock: TLS is not enabled")
+)
+
+// Close stops the server immediately, it closes the listener and all the
+// connections, even the ones in the middle of a command, and waits for all
+// the goroutines to finish
+func (s *Server) Close() error {
+	s.finish()
+	s.stop(true)
+	s.wait()
+	return nil
+}
+
+// Shutdown stops the server gracefully, it closes the listener and the idle
+// connections, then waits for the in-flight commands to finish and closes
+// their connections. if the ctx is done before that, all the connections are
+// closed like Close and the ctx error is returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.finish()
+	s.stop(false)
+
+	done := make(chan struct{})
+	go func() {
+		s.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.stop(true)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stop closes the listener and all the connections, like the redis server is
+// gone. the expectations and the calls are kept, and the server can be started
+// again on the same address with Start
+func (s *Server) Stop() error {
+	s.stop(true)
+	s.wg.Wait()
+	return nil
+}
+
+// Start starts the stopped server on the same address, it does nothing if the
+// server is running. a closed server can not be started
+func (s *Server) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrServerClosed
+	}
+	if !s.closing {
+		return nil
+	}
+	addr := s.listener.Addr()
+	return s.listen(addr.Network(), addr.String())
+}
+
+// Restart stops the server, waits for the downtime and starts it again on the
+// same address
+func (s *Server) Restart(downtime time.Duration) error {
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	time.Sleep(downtime)
+	return s.Start()
+}
+
+// listen starts listening on the address and serving the connections, the
+// lock must be held by the caller
+func (s *Server) listen(network, addr string) error {
+	var (
+		l   net.Listener
+		err error
+	)
+	if network == memoryNetwork {
+		s.memory = newMemoryListener(addr)
+		l = s.memory
+	} else if l, err = net.Listen(network, addr); err != nil {
+		return err
+	}
+	s.serveListener(l)
+	return nil
+}
+
+// serveListener starts serving the connections of the listener, the lock must
+// be held by the caller
+func (s *Server) serveListener(l net.Listener) {
+	if s.tls != nil {
+		l = tls.NewListener(l, s.tls.config)
+	}
+	s.listener = l
+	s.closing = false
+	s.wg.Add(1)
+	go s.serve(l)
+}
+
+// finish marks the server as closed, so it can not be started again
+func (s *Server) finish() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		if s.stopped != nil {
+			close(s.stopped)
+		}
+	}
+}
+
+// wait waits for all the goroutines of the server
+func (s *Server) wait() {
+	s.wg.Wait()
+	if s.watching != nil {
+		<-s.watching
+	}
+}
+
+// stop closes the listener and the idle connections, with force all the
+// connections are closed. it is safe to call it more than once
+func (s *Server) stop(force bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.closing {
+		s.closing = true
+		if s.listener != nil {
+			_ = s.listener.Close()
+		}
+	}
+	if s.closed {
+		// the listener removes the socket file on close, the directory is left
+		s.removeTemp()
+	}
+	for cl, busy := range s.conns {
+		// abort marks them as killed, so the error is ErrServerClosed
+		if force || !busy {
+			cl.abort()
+		}
+	}
+}
+
+// removeTemp removes the temporary directory of the unix socket
+func (s *Server) removeTemp() {
+	if s.tempDir != "" {
+		_ = os.RemoveAll(s.tempDir)
+		s.tempDir = ""
+	}
+}
+
+// killError is the error of a connection closed by the server, it is
+// ErrServerClosed if the server is closing and ErrConnectionKilled otherwise
+func (s *Server) killError() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closing {
+		return ErrServerClosed
+	}
+	return ErrConnectionKilled
+}
+
+// isClosed returns true if the channel is closed
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// track adds the client to the connection list, it returns ErrServerClosed if
+// the server is closing. if the server is full, the client is added as a
+// rejected one and errMaxClients is returned
+func (s *Server) track(cl *client) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closing {
+		return ErrServerClosed
+	}
+	if s.conns == nil {
+		s.conns = make(map[*client]bool)
+	}
+	var err error
+	if s.maxClients > 0 && s.liveClients() >= s.maxClients {
+		cl.rejected = true
+		err = errMaxClients
+	}
+	s.conns[cl] = false
+	return err
+}
+
+func (s *Server) untrack(cl *client) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.conns, cl)
+}
+
+// setBusy marks the client as busy when it is handling a command, the idle
+// clients are closed on Shutdown. it returns false if the server is closing
+func (s *Server) setBusy(cl *client, busy bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.conns[cl] = busy
+	return true
+}
+
+// sleep waits for d, it returns false if the abort channel is closed first
+func sleep(abort <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-abort:
+		return false
+	}
+}
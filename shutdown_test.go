@@ -0,0 +1,190 @@
+package redimock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	// the go-redis pool reaper does not stop on Close until its next tick
+	goleak.VerifyTestMain(m, goleak.IgnoreTopFunction("github.com/go-redis/redis/internal/pool.(*ConnPool).reaper"))
+}
+
+func TestServerClose(t *testing.T) {
+	s, err := NewServer(context.Background(), "")
+	require.NoError(t, err)
+	s.ExpectPing().Any()
+	s.ExpectGet("slow", true, "v").WithDelay(time.Hour).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := red.Do("GET", "slow")
+		errCh <- err
+	}()
+	waitBusy(t, s)
+
+	require.NoError(t, s.Close())
+	require.Error(t, <-errCh)
+	require.NoError(t, s.Close())
+
+	_, err = redis.Dial("tcp", s.Addr().String())
+	require.Error(t, err)
+}
+
+func TestServerShutdown(t *testing.T) {
+	disconnected := make(chan error, 2)
+	s, err := NewServer(context.Background(), "", WithOnDisconnect(func(_ ConnectionInfo, err error) {
+		disconnected <- err
+	}))
+	require.NoError(t, err)
+	s.ExpectPing().Any()
+	s.ExpectGet("key", true, "v").WithDelay(100 * time.Millisecond).Once()
+
+	idle, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	_, err = idle.Do("PING")
+	require.NoError(t, err)
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	type result struct {
+		v   string
+		err error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		v, err := redis.String(red.Do("GET", "key"))
+		resCh <- result{v: v, err: err}
+	}()
+	waitBusy(t, s)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	res := <-resCh
+	require.NoError(t, res.err, "the in-flight command must finish")
+	require.Equal(t, "v", res.v)
+
+	_, err = idle.Do("PING")
+	require.Error(t, err, "the idle connection must be closed")
+	_, err = red.Do("PING")
+	require.Error(t, err)
+
+	// both the idle and the in-flight connections
+	require.Equal(t, ErrServerClosed, <-disconnected)
+	require.Equal(t, ErrServerClosed, <-disconnected)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	s, err := NewServer(context.Background(), "")
+	require.NoError(t, err)
+	s.ExpectGet("key", true, "v").WithDelay(time.Hour).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := red.Do("GET", "key")
+		errCh <- err
+	}()
+	waitBusy(t, s)
+
+	ctx, cnl := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cnl()
+	require.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	require.Error(t, <-errCh)
+}
+
+func TestServerContextClose(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+	s.ExpectPing().Any()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	cnl()
+	_, err = red.Do("PING")
+	require.Error(t, err)
+	require.NoError(t, s.Close())
+}
+
+// waitBusy waits until a connection is handling a command
+func waitBusy(t *testing.T, s *Server) {
+	require.Eventually(t, func() bool {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		for _, busy := range s.conns {
+			if busy {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+}
+
+func TestServerRestart(t *testing.T) {
+	s, err := NewServer(context.Background(), "")
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.ExpectPing().Times(3)
+	addr := s.Addr().String()
+
+	red, err := redis.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Stop())
+	require.NoError(t, s.Stop())
+	_, err = red.Do("PING")
+	require.Error(t, err, "the connection must be closed")
+	_, err = redis.Dial("tcp", addr)
+	require.Error(t, err, "the server must not accept")
+
+	require.NoError(t, s.Start())
+	require.NoError(t, s.Start())
+	require.Equal(t, addr, s.Addr().String())
+
+	red2, err := redis.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer red2.Close()
+	_, err = red2.Do("PING")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Restart(10*time.Millisecond))
+	_, err = red2.Do("PING")
+	require.Error(t, err)
+
+	red3, err := redis.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer red3.Close()
+	_, err = red3.Do("PING")
+	require.NoError(t, err)
+
+	require.NoError(t, s.ExpectationsWereMet())
+	require.Len(t, s.Calls(), 3)
+
+	require.NoError(t, s.Close())
+	require.Equal(t, ErrServerClosed, s.Start())
+}
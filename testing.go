@@ -0,0 +1,70 @@
+package redimock
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// NewTestServer makes a server for the test on a random loopback port (or a
+// temporary socket with WithNetwork("unix")). the server is closed at the end
+// of the test and the expectations are verified. unexpected commands and the
+// failed writes are reported with t.Errorf as soon as they happen, with the
+// file and line of the NewTestServer call
+func NewTestServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	loc := "redimock"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		loc = fmt.Sprintf("redimock server at %s:%d", filepath.Base(file), line)
+	}
+
+	report := func(s *Server) {
+		s.reporter = func(msg string) {
+			t.Errorf("%s: %s", loc, msg)
+		}
+	}
+
+	ctx, cnl := context.WithCancel(context.Background())
+	s, err := NewServer(ctx, testAddr(opts), append([]Option{report}, opts...)...)
+	if err != nil {
+		cnl()
+		t.Fatalf("%s: %s", loc, err)
+	}
+
+	t.Cleanup(func() {
+		_ = s.Close()
+		cnl()
+		// the unexpected commands are already reported
+		if err := s.verify(false); err != nil {
+			t.Errorf("%s: %s", loc, err)
+		}
+	})
+	return s
+}
+
+// testAddr is the loopback address with a random port for the network in the
+// options, or a temporary socket for unix
+func testAddr(opts []Option) string {
+	var probe Server
+	for i := range opts {
+		opts[i](&probe)
+	}
+	switch probe.network {
+	case "unix", memoryNetwork:
+		return ""
+	case "tcp6":
+		return "[::1]:0"
+	default:
+		return "127.0.0.1:0"
+	}
+}
+
+// reportf reports the error to the test, if the server is made by NewTestServer
+func (s *Server) reportf(format string, args ...interface{}) {
+	if s.reporter != nil {
+		s.reporter(fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,120 @@
+package redimock
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTB struct {
+	testing.TB
+
+	lock     sync.Mutex
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) cleanup() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func (f *fakeTB) Errors() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]string(nil), f.errors...)
+}
+
+func TestNewTestServer(t *testing.T) {
+	s := NewTestServer(t)
+	s.ExpectGet("key", true, "value").Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	v, err := redis.String(red.Do("GET", "key"))
+	require.NoError(t, err)
+	require.Equal(t, "value", v)
+}
+
+func TestNewTestServerReport(t *testing.T) {
+	tb := &fakeTB{}
+	s := NewTestServer(tb)
+	s.ExpectGet("key", true, "value").Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("PING")
+	require.EqualError(t, err, "command not expected")
+
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Regexp(t, `^redimock server at testing_test.go:\d+: command PING is called but not expected$`, errs[0])
+
+	tb.cleanup()
+	errs = tb.Errors()
+	require.Len(t, errs, 2)
+	require.Regexp(t, `^redimock server at testing_test.go:\d+: command "GET" with args "key" expected 1 time called 0 times`, errs[1])
+}
+
+func TestNewTestServerFailFast(t *testing.T) {
+	tb := &fakeTB{}
+	s := NewTestServer(tb, WithFailFast())
+	s.ExpectPing().Any()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	_, err = red.Do("GET", "key")
+	require.EqualError(t, err, "command not expected")
+
+	_, err = red.Do("PING")
+	require.Error(t, err)
+
+	require.Len(t, tb.Errors(), 1)
+	tb.cleanup()
+	require.Len(t, tb.Errors(), 1)
+}
+
+func TestNewTestServerWriteError(t *testing.T) {
+	tb := &fakeTB{}
+	s := NewTestServer(tb)
+	s.Expect("GET").WillReturn(struct{}{}).Once()
+
+	red, err := redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+
+	_, err = red.Do("GET")
+	require.Error(t, err)
+
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Regexp(t, `writing the reply of GET failed: invalid type: struct {}$`, errs[0])
+	tb.cleanup()
+}
@@ -0,0 +1,196 @@
+package redimock
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+)
+
+// tlsState is the TLS configuration of the server, the CA is generated in
+// memory for each server
+type tlsState struct {
+	config *tls.Config
+	mutual bool
+
+	ca     *x509.Certificate
+	caKey  crypto.Signer
+	pool   *x509.CertPool
+	client tls.Certificate
+	// generated is true when the server certificate is signed by the CA, not
+	// the one in the config
+	generated bool
+}
+
+// WithTLS wraps the listener with TLS. with a nil config, a self-signed CA and
+// a server certificate for localhost, 127.0.0.1 and ::1 are generated in
+// memory, use TLSClientConfig or TLSRootCAs in the client
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		if s.tls == nil {
+			s.tls = &tlsState{}
+		}
+		s.tls.config = config
+	}
+}
+
+// WithMutualTLS enables TLS (like WithTLS(nil) if it is not enabled) and
+// requires a client certificate signed by the generated CA. the subject of the
+// client certificate is in Call.TLSSubject
+func WithMutualTLS() Option {
+	return func(s *Server) {
+		if s.tls == nil {
+			s.tls = &tlsState{}
+		}
+		s.tls.mutual = true
+	}
+}
+
+// NewTLSServer makes a server like NewServer with WithTLS(nil)
+func NewTLSServer(ctx context.Context, addr string, opts ...Option) (*Server, error) {
+	return NewServer(ctx, addr, append([]Option{WithTLS(nil)}, opts...)...)
+}
+
+// setup generates the CA and the certificates
+func (ts *tlsState) setup() error {
+	var err error
+	ts.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	tpl := certTemplate("redimock CA")
+	tpl.IsCA = true
+	tpl.BasicConstraintsValid = true
+	tpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, ts.caKey.Public(), ts.caKey)
+	if err != nil {
+		return err
+	}
+	if ts.ca, err = x509.ParseCertificate(der); err != nil {
+		return err
+	}
+	ts.pool = x509.NewCertPool()
+	ts.pool.AddCert(ts.ca)
+
+	if ts.client, err = ts.issue("redimock client", x509.ExtKeyUsageClientAuth); err != nil {
+		return err
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ts.config != nil {
+		config = ts.config.Clone()
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		cert, err := ts.issue("redimock server", x509.ExtKeyUsageServerAuth)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+		ts.generated = true
+	}
+	if ts.mutual {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if config.ClientCAs == nil {
+			config.ClientCAs = ts.pool
+		}
+	}
+	ts.config = config
+	return nil
+}
+
+// issue makes a certificate signed by the CA
+func (ts *tlsState) issue(commonName string, usage x509.ExtKeyUsage) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tpl := certTemplate(commonName)
+	tpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	if usage == x509.ExtKeyUsageServerAuth {
+		tpl.DNSNames = []string{"localhost"}
+		tpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ts.ca, key.Public(), ts.caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+func certTemplate(commonName string) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"redimock"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+}
+
+// TLSRootCAs is the pool with the generated CA, nil if TLS is not enabled or
+// the server certificate is in the config of WithTLS, since the pool does not
+// trust it
+func (s *Server) TLSRootCAs() *x509.CertPool {
+	if s.tls == nil || !s.tls.generated {
+		return nil
+	}
+	return s.tls.pool
+}
+
+// TLSClientConfig is a client config trusting the generated CA, with the
+// server name set to localhost. with WithMutualTLS it has a client certificate
+// with "redimock client" as the common name. it is nil if TLS is not enabled or
+// the server certificate is in the config of WithTLS, like TLSRootCAs
+func (s *Server) TLSClientConfig() *tls.Config {
+	if s.tls == nil || !s.tls.generated {
+		return nil
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    s.tls.pool,
+		ServerName: "localhost",
+	}
+	if s.tls.mutual {
+		config.Certificates = []tls.Certificate{s.tls.client}
+	}
+	return config
+}
+
+// IssueClientCertificate makes a client certificate signed by the generated
+// CA, to test the clients with different subjects in mutual TLS
+func (s *Server) IssueClientCertificate(commonName string) (tls.Certificate, error) {
+	if s.tls == nil {
+		return tls.Certificate{}, ErrTLSDisabled
+	}
+	return s.tls.issue(commonName, x509.ExtKeyUsageClientAuth)
+}
+
+// handshake does the TLS handshake and keeps the connection state for the
+// journal, it does nothing for the other connections
+func (c *client) handshake() error {
+	conn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	state := conn.ConnectionState()
+	c.tlsServerName = state.ServerName
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		c.tlsSubject = state.VerifiedChains[0][0].Subject.String()
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package redimock
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSServer(t *testing.T) {
+	s, err := NewTLSServer(context.Background(), "127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+	s.ExpectPing().Any()
+
+	red, err := redis.Dial("tcp", s.Addr().String(),
+		redis.DialUseTLS(true), redis.DialTLSConfig(s.TLSClientConfig()))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	calls := s.Calls()
+	require.Len(t, calls, 1)
+	require.Equal(t, "localhost", calls[0].TLSServerName)
+	require.Empty(t, calls[0].TLSSubject)
+
+	// the certificate is valid for the ip too
+	red, err = redis.Dial("tcp", s.Addr().String(), redis.DialUseTLS(true),
+		redis.DialTLSConfig(&tls.Config{RootCAs: s.TLSRootCAs(), ServerName: "127.0.0.1"}))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	// the CA is not trusted
+	red, err = redis.Dial("tcp", s.Addr().String(), redis.DialUseTLS(true),
+		redis.DialTLSConfig(&tls.Config{ServerName: "localhost"}))
+	if err == nil {
+		_, err = red.Do("PING")
+		_ = red.Close()
+	}
+	require.Error(t, err)
+
+	// plain text is not accepted
+	red, err = redis.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.Error(t, err)
+
+	require.NoError(t, s.Restart(0))
+	red, err = redis.Dial("tcp", s.Addr().String(),
+		redis.DialUseTLS(true), redis.DialTLSConfig(s.TLSClientConfig()))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+}
+
+func TestMutualTLS(t *testing.T) {
+	s := NewTestServer(t, WithMutualTLS())
+	s.ExpectPing().Times(2)
+
+	red, err := redis.Dial("tcp", s.Addr().String(),
+		redis.DialUseTLS(true), redis.DialTLSConfig(s.TLSClientConfig()))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	cert, err := s.IssueClientCertificate("app")
+	require.NoError(t, err)
+	config := s.TLSClientConfig()
+	config.Certificates = []tls.Certificate{cert}
+	red, err = redis.Dial("tcp", s.Addr().String(), redis.DialUseTLS(true), redis.DialTLSConfig(config))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+
+	calls := s.Calls()
+	require.Len(t, calls, 2)
+	require.Equal(t, "CN=redimock client,O=redimock", calls[0].TLSSubject)
+	require.Equal(t, "CN=app,O=redimock", calls[1].TLSSubject)
+
+	// without a client certificate
+	config.Certificates = nil
+	red, err = redis.Dial("tcp", s.Addr().String(), redis.DialUseTLS(true), redis.DialTLSConfig(config))
+	if err == nil {
+		_, err = red.Do("PING")
+		_ = red.Close()
+	}
+	require.Error(t, err)
+}
+
+func TestTLSDial(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"), WithTLS(nil))
+	s.ExpectPing().Once()
+
+	// the connection is already wrapped with TLS
+	red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+	require.Equal(t, "localhost", s.Calls()[0].TLSServerName)
+}
+
+func TestTLSOwnCertificate(t *testing.T) {
+	other, err := NewTLSServer(context.Background(), "127.0.0.1:0")
+	require.NoError(t, err)
+	defer other.Close()
+	cert, err := other.tls.issue("redimock server", x509.ExtKeyUsageServerAuth)
+	require.NoError(t, err)
+
+	s := NewTestServer(t, WithTLS(&tls.Config{Certificates: []tls.Certificate{cert}}))
+	s.ExpectPing().Once()
+	require.Nil(t, s.TLSRootCAs(), "the generated CA does not trust the certificate")
+	require.Nil(t, s.TLSClientConfig())
+
+	// the connection of Dial is not wrapped
+	red, err := redis.Dial("", "", redis.DialNetDial(s.Dial), redis.DialUseTLS(true),
+		redis.DialTLSConfig(other.TLSClientConfig()))
+	require.NoError(t, err)
+	defer red.Close()
+	_, err = red.Do("PING")
+	require.NoError(t, err)
+}
+
+func TestTLSDisabled(t *testing.T) {
+	s := NewTestServer(t)
+	require.Nil(t, s.TLSRootCAs())
+	require.Nil(t, s.TLSClientConfig())
+	_, err := s.IssueClientCertificate("app")
+	require.Equal(t, ErrTLSDisabled, err)
+}
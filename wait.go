@@ -0,0 +1,116 @@
+package redimock
+
+import (
+	"context"
+	"strings"
+)
+
+// WaitCalled waits until the command is called at least n times, or the
+// context is done. the calls are counted when they are in the journal with the
+// reply, so Calls has them when it returns
+func (c *Command) WaitCalled(ctx context.Context, n int) error {
+	for {
+		c.lock.Lock()
+		if c.repliedTimes() >= n {
+			c.lock.Unlock()
+			return nil
+		}
+		if c.changed == nil {
+			c.changed = make(chan struct{})
+		}
+		ch := c.changed
+		c.lock.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WaitForCommand waits until the server receives the command with the
+// arguments matching the matchers, and returns the call. without matchers any
+// argument is accepted. the calls received before this function are also
+// checked, so it returns immediately if the command is already received. like
+// WaitCalled, only the calls with the reply are considered
+func (s *Server) WaitForCommand(ctx context.Context, command string, matchers ...ArgMatcher) (Call, error) {
+	c := &Command{
+		command: strings.ToUpper(command),
+	}
+	if len(matchers) > 0 {
+		c.WithArgMatchers(matchers...)
+	} else {
+		c.WithAnyArgs()
+	}
+
+	var checked int
+	for {
+		s.lock.Lock()
+		pending := false
+		for i := checked; i < len(s.calls); i++ {
+			call := s.calls[i]
+			if call.RepliedAt.IsZero() {
+				// check it again after the reply
+				pending = true
+				continue
+			}
+			if c.compare(append([]string{call.Command}, call.Args...)) {
+				s.lock.Unlock()
+				return call, nil
+			}
+			if !pending {
+				checked = i + 1
+			}
+		}
+		if s.changed == nil {
+			s.changed = make(chan struct{})
+		}
+		ch := s.changed
+		s.lock.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return Call{}, ctx.Err()
+		}
+	}
+}
+
+// Done returns a channel that is closed when all the expectations with the
+// count (Once or Times) are called at least the expected times. expectations
+// with Any are ignored. the channel is closed only once, expectations added
+// after that are not considered
+func (s *Server) Done() <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.done == nil {
+		s.done = make(chan struct{})
+		s.checkDone()
+	}
+	return s.done
+}
+
+// checkDone closes the done channel if all the expectations are satisfied, the
+// lock must be held by the caller
+func (s *Server) checkDone() {
+	if s.done == nil {
+		return
+	}
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	for i := range s.expectList {
+		cmd := s.expectList[i]
+		cmd.lock.RLock()
+		n := cmd.repliedTimes()
+		cmd.lock.RUnlock()
+		if !cmd.satisfied(n, false) {
+			return
+		}
+	}
+	close(s.done)
+}
@@ -0,0 +1,135 @@
+package redimock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitCalled(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	cmd := s.Expect("LPUSH").WithArgMatchers(Equal("jobs"), AnyArg()).WillReturn(1).Times(3)
+	ping := s.ExpectPing().Any()
+
+	go func() {
+		red, err := redis.Dial("tcp", s.Addr().String())
+		if err != nil {
+			return
+		}
+		defer red.Close()
+		for i := 0; i < 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+			_, _ = red.Do("LPUSH", "jobs", i)
+		}
+	}()
+
+	wCtx, wCnl := context.WithTimeout(ctx, 5*time.Second)
+	defer wCnl()
+	require.NoError(t, cmd.WaitCalled(wCtx, 3))
+	require.NoError(t, cmd.WaitCalled(wCtx, 1))
+
+	call, err := s.WaitForCommand(wCtx, "lpush", Equal("jobs"), Equal("2"))
+	require.NoError(t, err)
+	require.Equal(t, "LPUSH jobs 2", call.String())
+
+	tCtx, tCnl := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer tCnl()
+	require.Equal(t, context.DeadlineExceeded, ping.WaitCalled(tCtx, 1))
+	_, err = s.WaitForCommand(tCtx, "PING")
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		red, err := redis.Dial("tcp", s.Addr().String())
+		if err != nil {
+			return
+		}
+		defer red.Close()
+		time.Sleep(10 * time.Millisecond)
+		_, _ = red.Do("PING", "HI")
+	}()
+	call, err = s.WaitForCommand(wCtx, "PING")
+	require.NoError(t, err)
+	require.Equal(t, []string{"HI"}, call.Args)
+
+	require.NoError(t, s.ExpectationsWereMet())
+}
+
+func TestServerDone(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+
+	s, err := NewServer(ctx, "")
+	require.NoError(t, err)
+
+	s.ExpectGet("a", true, "1").Once()
+	s.ExpectGet("b", true, "2").Times(2)
+	s.ExpectPing().Any()
+
+	done := s.Done()
+	require.Equal(t, done, s.Done())
+
+	go func() {
+		red, err := redis.Dial("tcp", s.Addr().String())
+		if err != nil {
+			return
+		}
+		defer red.Close()
+		for _, k := range []string{"a", "b", "b"} {
+			time.Sleep(10 * time.Millisecond)
+			_, _ = red.Do("GET", k)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timeout")
+	}
+	require.NoError(t, s.ExpectationsWereMet())
+
+	empty := &Server{}
+	select {
+	case <-empty.Done():
+	default:
+		require.FailNow(t, "should be closed")
+	}
+}
+
+func TestWaitCalledJournal(t *testing.T) {
+	s := NewTestServer(t, WithNetwork("memory"))
+	cmd := s.Expect("INCR").WithArgs("counter").WillReturn(1).Times(20)
+
+	go func() {
+		red, err := redis.Dial("", "", redis.DialNetDial(s.Dial))
+		if err != nil {
+			return
+		}
+		defer red.Close()
+		for i := 0; i < 20; i++ {
+			_, _ = red.Do("INCR", "counter")
+		}
+	}()
+
+	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cnl()
+	for n := 1; n <= 20; n++ {
+		require.NoError(t, cmd.WaitCalled(ctx, n))
+		calls := cmd.Calls()
+		require.GreaterOrEqual(t, len(calls), n)
+		require.False(t, calls[n-1].RepliedAt.IsZero())
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("done must agree with WaitCalled")
+	}
+	require.Len(t, s.Calls(), 20)
+}